@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coveooss/gotemplate/v3/collections"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TGFAlias is the structured definition of an alias, an alias could also simply be defined by its command
+type TGFAlias struct {
+	Command     string            `yaml:"command,omitempty" json:"command,omitempty" hcl:"command,omitempty"`
+	Description string            `yaml:"description,omitempty" json:"description,omitempty" hcl:"description,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty" json:"env,omitempty" hcl:"env,omitempty"`
+}
+
+// Positional parameters of an alias command ($1 to $9 or $@ for all the arguments)
+var reAliasParameter = regexp.MustCompile(`\$(@|[1-9])`)
+
+// getAlias returns the definition of the alias, the alias value could either be a string (the command) or a structure
+func (config *TGFConfig) getAlias(name string) (alias TGFAlias, found bool) {
+	switch value := config.Aliases[name].(type) {
+	case nil:
+		return
+	case string:
+		alias.Command = value
+	default:
+		content, err := yaml.Marshal(unwrapHCLBlocks(value))
+		if err == nil {
+			err = collections.ConvertData(string(content), &alias)
+		}
+		if err != nil {
+			log.Warningf("Invalid alias %s: %v", name, err)
+			return
+		}
+	}
+	return alias, strings.TrimSpace(alias.Command) != ""
+}
+
+// unwrapHCLBlocks replaces the HCL blocks (decoded as lists containing a single map) by their map
+func unwrapHCLBlocks(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() == 1 {
+			if item := v.Index(0).Interface(); reflect.ValueOf(item).Kind() == reflect.Map {
+				return unwrapHCLBlocks(item)
+			}
+		}
+	case reflect.Map:
+		result := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			result[fmt.Sprint(key.Interface())] = unwrapHCLBlocks(v.MapIndex(key).Interface())
+		}
+		return result
+	}
+	return value
+}
+
+// parseAliases will parse the original argument list and replace aliases only in the first argument. The arguments
+// following the alias are used by its positional parameters ($1, $@), the unused ones are added at the end.
+func (config *TGFConfig) parseAliases(args []string) ([]string, map[string]string) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	alias, found := config.getAlias(args[0])
+	if !found {
+		return args, nil
+	}
+
+	replace, quoted := String(alias.Command).Protect()
+	fields := replace.Fields()
+	parameters, used, usedAll := args[1:], 0, false
+	result := make([]string, 0, len(fields)+len(parameters))
+	for _, field := range fields {
+		if len(quoted) > 0 {
+			field = field.RestoreProtected(quoted).ReplaceN(`="`, "=", 1).Trim(`"`)
+		}
+		if field == "$@" {
+			result, usedAll = append(result, parameters...), true
+			continue
+		}
+		value := reAliasParameter.ReplaceAllStringFunc(field.Str(), func(match string) string {
+			if match == "$@" {
+				usedAll = true
+				return strings.Join(parameters, " ")
+			}
+			index := int(match[1] - '0')
+			if index > used {
+				used = index
+			}
+			if index > len(parameters) {
+				return ""
+			}
+			return parameters[index-1]
+		})
+		if value != "" || !reAliasParameter.MatchString(field.Str()) {
+			// The parameters that are not supplied are removed
+			result = append(result, value)
+		}
+	}
+	if !usedAll && used < len(parameters) {
+		result = append(result, parameters[used:]...)
+	}
+
+	result, env := config.parseAliases(result)
+	if len(alias.Env) > 0 {
+		// The environment of the alias has precedence over the one of the aliases it uses
+		merged := make(map[string]string, len(alias.Env)+len(env))
+		for key, value := range env {
+			merged[key] = value
+		}
+		for key, value := range alias.Env {
+			merged[key] = value
+		}
+		env = merged
+	}
+	return result, env
+}
+
+// ParseAliases checks if the actual command matches an alias and set the options according to the configuration
+func (config *TGFConfig) ParseAliases() {
+	args := config.tgf.Unmanaged
+	alias, env := config.parseAliases(args)
+	for key, value := range env {
+		if config.Environment == nil {
+			config.Environment = make(map[string]string)
+		}
+		config.Environment[key] = value
+	}
+	if len(alias) > 0 && len(args) > 0 && alias[0] != args[0] {
+		config.tgf.Unmanaged = nil
+		must(config.tgf.Application.Parse(alias))
+	}
+}
+
+// aliasesUsage returns the list of the aliases with their description (or their command if there is no description)
+func (config *TGFConfig) aliasesUsage() string {
+	aliases := make(map[string]TGFAlias, len(config.Aliases))
+	names := make([]string, 0, len(config.Aliases))
+	width := 0
+	for name := range config.Aliases {
+		if alias, found := config.getAlias(name); found {
+			aliases[name] = alias
+			names = append(names, name)
+			if len(name) > width {
+				width = len(name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var usage strings.Builder
+	usage.WriteString("Aliases:\n")
+	for _, name := range names {
+		alias := aliases[name]
+		description := alias.Description
+		if description == "" {
+			description = alias.Command
+		}
+		fmt.Fprintf(&usage, "  %-*s  %s\n", width, name, description)
+	}
+	return usage.String()
+}
+
+// loadAliases returns the configuration holding the aliases without accessing the network (the remote configuration is read from
+// the cache), it is used to complete the command line and display the help
+func (app *TGFApplication) loadAliases() *TGFConfig {
+	offline := app.Offline
+	app.Offline = true
+	defer func() { app.Offline = offline }()
+	// The configuration is silently read, the errors are reported when the command is run
+	level := log.GetDefaultConsoleHookLevel()
+	_ = log.SetDefaultConsoleHookLevel(logrus.PanicLevel)
+	defer func() { _ = log.SetDefaultConsoleHookLevel(level) }()
+	return newConfig(app)
+}
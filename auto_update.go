@@ -1,83 +1,338 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"runtime"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/blang/semver/v4"
+	"github.com/coveooss/gotemplate/v3/collections"
+	"github.com/minio/selfupdate"
 )
 
 const locallyBuilt = "(Locally Built)"
 const autoUpdateFile = "TGFAutoUpdate"
+const rolledBackFile = "rolled-back-version"
 
 //go:generate moq -out runner_updater_moq_test.go . RunnerUpdater
 
 // RunnerUpdater allows flexibility for testing
 type RunnerUpdater interface {
 	GetUpdateVersion() (string, error)
+	GetUpdateURL(version string) string
 	GetLastRefresh(file string) time.Duration
 	SetLastRefresh(file string)
 	ShouldUpdate() bool
+	UpdateInBackground() bool
 	DoUpdate(url string) (err error)
+	StageUpdate(url string) (file string, err error)
+	ApplyUpdate(file string) error
 	Run() int
 	Restart() int
 }
 
-// RunWithUpdateCheck checks if an update is due, checks if current version is outdated and performs update if needed
+// Delay granted to a background update to be staged once the command is completed
+var backgroundUpdateWait = 2 * time.Second
+
+// RunWithUpdateCheck checks if an update is due, checks if current version is outdated and performs update if needed.
+// The automatic updates are done in background while the command runs and applied at exit, the forced updates
+// (--update) are applied before running the command.
 func RunWithUpdateCheck(c RunnerUpdater) int {
 	if !c.ShouldUpdate() {
 		return c.Run()
 	}
+	if c.UpdateInBackground() {
+		return runWithBackgroundUpdate(c)
+	}
 
-	log.Debug("Comparing local and latest versions...")
 	c.SetLastRefresh(autoUpdateFile)
+	latestVersion, url := checkForUpdate(c)
+	if url == "" {
+		return c.Run()
+	}
+
+	executablePath, err := os.Executable()
+	if err != nil {
+		log.Errorln("Executable path error:", err)
+	}
+
+	log.Warningf("Updating %s from %s ==> %v", executablePath, version, latestVersion)
+	if err := c.DoUpdate(url); err != nil {
+		log.Errorf("Failed update for %s: %v", url, err)
+		return c.Run()
+	}
+
+	log.Infoln("TGF updated to", latestVersion)
+	log.Warning("TGF is restarting...")
+	return c.Restart()
+}
+
+// checkForUpdate returns the latest version and the url of its archive if it is newer than the current version
+func checkForUpdate(c RunnerUpdater) (latestVersion semver.Version, url string) {
+	log.Debug("Comparing local and latest versions...")
 	updateVersion, err := c.GetUpdateVersion()
 	if err != nil {
 		log.Errorln("Error fetching update version:", err)
-		return c.Run()
+		return
 	}
-	latestVersion, err := semver.Make(updateVersion)
+	latestVersion, err = semver.Make(updateVersion)
 	if err != nil {
 		log.Errorf(`Semver error on retrieved version "%s" : %v`, updateVersion, err)
-		return c.Run()
+		return
 	}
 
 	currentVersion, err := semver.Make(version)
 	if err != nil {
 		log.Warningf(`Semver error on current version "%s": %v`, version, err)
-		return c.Run()
+		return
 	}
 
 	if currentVersion.GTE(latestVersion) {
 		log.Debugf("Your current version (%v) is up to date.", currentVersion)
-		return c.Run()
+		return
+	}
+	if c.UpdateInBackground() && getRolledBackVersion() == latestVersion.String() {
+		log.Debugf("The version %v has been rolled back, it is only installed with --update", latestVersion)
+		return
+	}
+	return latestVersion, c.GetUpdateURL(latestVersion.String())
+}
+
+// runWithBackgroundUpdate stages the newer version while the command runs and applies it at exit. If the update is
+// not ready shortly after the command completes, it is abandoned and retried on the next run.
+func runWithBackgroundUpdate(c RunnerUpdater) int {
+	type stagedUpdate struct {
+		version semver.Version
+		file    string
+	}
+	staged := make(chan *stagedUpdate)
+	abandoned := make(chan bool)
+	resetStagedFiles()
+	go func() {
+		defer close(staged)
+		latestVersion, url := checkForUpdate(c)
+		if url == "" {
+			c.SetLastRefresh(autoUpdateFile)
+			return
+		}
+		log.Debugf("Downloading tgf %v in background", latestVersion)
+		file, err := c.StageUpdate(url)
+		if err != nil {
+			log.Errorf("Failed update for %s: %v", url, err)
+			return
+		}
+		// The refresh marker is only updated once the update is staged, an abandoned update is retried on the next run
+		c.SetLastRefresh(autoUpdateFile)
+		select {
+		case staged <- &stagedUpdate{latestVersion, file}:
+		case <-abandoned:
+			os.Remove(file)
+		}
+	}()
+
+	exitCode := c.Run()
+	select {
+	case update := <-staged:
+		if update == nil {
+			break
+		}
+		if err := c.ApplyUpdate(update.file); err != nil {
+			log.Errorf("Failed update to %v: %v", update.version, err)
+			break
+		}
+		log.Warningf("TGF has been updated from %s to %v, the new version will be used on the next run", version, update.version)
+	case <-time.After(backgroundUpdateWait):
+		close(abandoned)
+		abandonStagedFiles()
+		log.Debug("The update of tgf is not ready, it will be retried on the next run")
 	}
+	return exitCode
+}
+
+// stagedFiles keeps track of the staged updates, they are removed if the update is abandoned since the process exits
+// while the background download still holds them
+var stagedFiles struct {
+	sync.Mutex
+	names     []string
+	abandoned bool
+}
 
-	url := PlatformZipURL(latestVersion.String())
+// createStagedFile creates the temporary file receiving a staged update, it fails once the update has been abandoned
+func createStagedFile() (*os.File, error) {
+	stagedFiles.Lock()
+	defer stagedFiles.Unlock()
+	if stagedFiles.abandoned {
+		return nil, errors.New("the update has been abandoned")
+	}
+	file, err := ioutil.TempFile("", "tgf.staged-version")
+	if err == nil {
+		stagedFiles.names = append(stagedFiles.names, file.Name())
+	}
+	return file, err
+}
 
+// abandonStagedFiles removes the staged updates and prevents the creation of new ones
+func abandonStagedFiles() {
+	stagedFiles.Lock()
+	defer stagedFiles.Unlock()
+	stagedFiles.abandoned = true
+	for _, name := range stagedFiles.names {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Debugf("Unable to remove the staged update %s: %v", name, err)
+		}
+	}
+	stagedFiles.names = nil
+}
+
+func resetStagedFiles() {
+	stagedFiles.Lock()
+	defer stagedFiles.Unlock()
+	stagedFiles.names, stagedFiles.abandoned = nil, false
+}
+
+// getPreviousVersionPath returns the file where the previous version of tgf is kept by the update (in the same folder
+// as the executable since the file is moved)
+func getPreviousVersionPath() (string, error) {
 	executablePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(executablePath); err == nil {
+		executablePath = resolved
+	}
+	return filepath.Join(filepath.Dir(executablePath), ".tgf.previous-version"), nil
+}
+
+// Rollback restores the version of tgf replaced by the last update, the current version is kept to allow going back
+func Rollback() int {
+	previousPath, err := getPreviousVersionPath()
 	if err != nil {
 		log.Errorln("Executable path error:", err)
+		return 1
+	}
+	content, err := ioutil.ReadFile(previousPath)
+	if os.IsNotExist(err) {
+		log.Error("There is no previous version of tgf to restore")
+		return 1
+	} else if err != nil {
+		log.Errorln("Unable to read the previous version of tgf:", err)
+		return 1
 	}
+	if err := selfupdate.Apply(bytes.NewReader(content), selfupdate.Options{OldSavePath: previousPath}); err != nil {
+		if err := selfupdate.RollbackError(err); err != nil {
+			log.Errorln("Failed to rollback from bad restore:", err)
+		}
+		log.Errorln("Unable to restore the previous version of tgf:", err)
+		return 1
+	}
+	setRolledBackVersion(version)
+	log.Infof("TGF %s has been replaced by the previous version, it will not be installed again by the automatic updates (run tgf --rollback again to restore it)", version)
+	return 0
+}
 
-	log.Warningf("Updating %s from %s ==> %v", executablePath, version, latestVersion)
-	if err := c.DoUpdate(url); err != nil {
-		log.Errorf("Failed update for %s: %v", url, err)
-		return c.Run()
+// getRolledBackVersion returns the version replaced by the last rollback, the automatic updates do not install it again
+func getRolledBackVersion() string {
+	folder, err := getTgfFolder()
+	if err != nil {
+		return ""
 	}
+	content, _ := ioutil.ReadFile(filepath.Join(folder, rolledBackFile))
+	return strings.TrimSpace(string(content))
+}
 
-	log.Infoln("TGF updated to", latestVersion)
-	log.Warning("TGF is restarting...")
-	return c.Restart()
+func setRolledBackVersion(version string) {
+	folder, err := getTgfFolder()
+	if err == nil {
+		if err = os.MkdirAll(folder, 0755); err == nil {
+			err = ioutil.WriteFile(filepath.Join(folder, rolledBackFile), []byte(version+"\n"), 0644)
+		}
+	}
+	if err != nil {
+		log.Warningf("Unable to record the rolled back version, the automatic updates may install %s again (set update-version or disable auto-update): %v", version, err)
+	}
+}
+
+// getZipName returns the name of the archive published for the platform (see .goreleaser.yml)
+func getZipName(version, goos, goarch string) string {
+	if goos == "darwin" {
+		goos = "macOS"
+	}
+	if goarch == "amd64" {
+		goarch = "64-bits"
+	}
+	return fmt.Sprintf("tgf_%s_%s_%s.zip", version, goos, goarch)
+}
+
+// splitUpdateURL returns the folder, the file name and the query (with its ?) of the url
+func splitUpdateURL(url string) (folder, name, query string) {
+	url, query = collections.Split2(url, "?")
+	if query != "" {
+		query = "?" + query
+	}
+	folder, name = path.Split(url)
+	return
+}
+
+// getChecksumsURL returns the url of the checksums file published with the archive (tgf_<version>_checksums.txt)
+func getChecksumsURL(zipURL string) string {
+	folder, name, query := splitUpdateURL(zipURL)
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) < 3 {
+		return folder + "checksums.txt" + query
+	}
+	return fmt.Sprintf("%s%s_%s_checksums.txt%s", folder, parts[0], parts[1], query)
+}
+
+// verifyUpdateArchive ensures that the downloaded archive matches the checksums published with the release. If
+// update-public-key is set, the checksums file must also be signed (cosign sign-blob signature in <checksums>.sig).
+func (config *TGFConfig) verifyUpdateArchive(url string, content []byte) error {
+	checksumsURL := getChecksumsURL(url)
+	checksums, err := downloadUpdateFile(checksumsURL)
+	if err != nil {
+		return fmt.Errorf("unable to get the checksums %s: %w", checksumsURL, err)
+	}
+	if config.UpdatePublicKey != "" {
+		publicKey, err := loadPublicKey(config.UpdatePublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid update-public-key: %w", err)
+		}
+		folder, name, query := splitUpdateURL(checksumsURL)
+		encoded, err := downloadUpdateFile(folder + name + ".sig" + query)
+		if err != nil {
+			return fmt.Errorf("unable to get the signature of %s: %w", checksumsURL, err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			return fmt.Errorf("invalid signature of %s: %w", checksumsURL, err)
+		}
+		if err := verifySignature(publicKey, checksums, signature); err != nil {
+			return fmt.Errorf("invalid signature of %s: %w", checksumsURL, err)
+		}
+	}
+	_, name, _ := splitUpdateURL(url)
+	return verifyChecksum(name, content, checksums)
 }
 
-// PlatformZipURL compute the uri pointing at the given version of tgf zip
-func PlatformZipURL(version string) string {
-	name := runtime.GOOS
-	if name == "darwin" {
-		name = "macOS"
+// verifyChecksum checks the sha256 of the file against the checksums file (<sha256>  <filename> lines)
+func verifyChecksum(name string, content, checksums []byte) error {
+	sum := sha256.Sum256(content)
+	for _, line := range strings.Split(string(checksums), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+				return fmt.Errorf("the checksum of %s does not match the published one", name)
+			}
+			return nil
+		}
 	}
-	return fmt.Sprintf("https://github.com/coveo/tgf/releases/download/v%[1]s/tgf_%[1]s_%[2]s_64-bits.zip", version, name)
+	return fmt.Errorf("%s is not listed in the checksums", name)
 }
@@ -2,8 +2,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -16,19 +26,28 @@ func TestMain(m *testing.M) {
 	// We don't want detailled logs in trace (time will always be different)
 	log.SetFormat("%level:upper%: %message%")
 	log.SetDefaultConsoleHookLevel(logrus.DebugLevel)
-	os.Exit(m.Run())
+
+	// The tests must not read nor modify the state of the current user (~/.tgf)
+	tgfFolder = must(ioutil.TempDir("", "tgf-test")).(string)
+	exitCode := m.Run()
+	os.RemoveAll(tgfFolder)
+	os.Exit(exitCode)
 }
 
 func setupUpdaterMock(localVersion string, latestVersion string) *RunnerUpdaterMock {
 	version = localVersion
 	return &RunnerUpdaterMock{
-		GetUpdateVersionFunc: func() (string, error) { return latestVersion, nil }, // Remote version
-		GetLastRefreshFunc:   func(string) time.Duration { return 0 * time.Hour },  // Force update
-		SetLastRefreshFunc:   func(string) {},
-		ShouldUpdateFunc:     func() bool { return true },
-		RunFunc:              func() int { return 0 },
-		RestartFunc:          func() int { return 0 },
-		DoUpdateFunc:         func(url string) (err error) { return nil },
+		GetUpdateVersionFunc:   func() (string, error) { return latestVersion, nil }, // Remote version
+		GetLastRefreshFunc:     func(string) time.Duration { return 0 * time.Hour },  // Force update
+		GetUpdateURLFunc:       func(version string) string { return "https://server/tgf_" + version + ".zip" },
+		SetLastRefreshFunc:     func(string) {},
+		ShouldUpdateFunc:       func() bool { return true },
+		RunFunc:                func() int { return 0 },
+		RestartFunc:            func() int { return 0 },
+		DoUpdateFunc:           func(url string) (err error) { return nil },
+		UpdateInBackgroundFunc: func() bool { return false },
+		StageUpdateFunc:        func(url string) (string, error) { return "staged", nil },
+		ApplyUpdateFunc:        func(file string) error { return nil },
 	}
 }
 
@@ -77,6 +96,78 @@ func TestRunWithUpdateCheck(t *testing.T) {
 	}
 }
 
+func TestRunWithBackgroundUpdate(t *testing.T) {
+	defer func(wait time.Duration) { backgroundUpdateWait = wait }(backgroundUpdateWait)
+	backgroundUpdateWait = 100 * time.Millisecond
+
+	tests := []struct {
+		name               string
+		local              string
+		latest             string
+		stageDelay         time.Duration
+		applyCount         int
+		refreshCount       int
+		expectedLogPattern string
+	}{
+		{"update", "1.20.0", "1.21.0", 0, 1, 1, `WARNING: TGF has been updated from 1.20.0 to 1.21.0, the new version will be used on the next run`},
+		{"up to date", "1.21.0", "1.21.0", 0, 0, 1, `DEBUG: Your current version \(1.21.0\) is up to date.`},
+		{"slow download", "1.20.0", "1.21.0", time.Second, 0, 0, `DEBUG: The update of tgf is not ready, it will be retried on the next run`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			log.SetOut(&buffer)
+			mockUpdater := setupUpdaterMock(tt.local, tt.latest)
+			mockUpdater.UpdateInBackgroundFunc = func() bool { return true }
+			staged := make(chan string, 1)
+			mockUpdater.StageUpdateFunc = func(url string) (string, error) {
+				file, err := createStagedFile()
+				if err != nil {
+					return "", err
+				}
+				file.Close()
+				staged <- file.Name()
+				time.Sleep(tt.stageDelay)
+				return file.Name(), nil
+			}
+			mockUpdater.ApplyUpdateFunc = func(file string) error { return os.Remove(file) }
+			assert.Equal(t, 0, RunWithUpdateCheck(mockUpdater))
+			assert.Regexp(t, tt.expectedLogPattern, buffer.String())
+			assert.Len(t, mockUpdater.RunCalls(), 1, "Run calls")
+			assert.Len(t, mockUpdater.RestartCalls(), 0, "Restart calls")
+			assert.Len(t, mockUpdater.ApplyUpdateCalls(), tt.applyCount, "ApplyUpdate calls")
+			assert.Len(t, mockUpdater.SetLastRefreshCalls(), tt.refreshCount, "SetLastRefresh calls")
+			select {
+			case file := <-staged:
+				assert.NoFileExists(t, file, "The staged file is removed")
+			default:
+			}
+		})
+	}
+}
+
+func TestRolledBackVersionSkipped(t *testing.T) {
+	defer os.Remove(filepath.Join(tgfFolder, rolledBackFile))
+	setRolledBackVersion("1.21.0")
+
+	var buffer bytes.Buffer
+	log.SetOut(&buffer)
+	mockUpdater := setupUpdaterMock("1.20.0", "1.21.0")
+	mockUpdater.UpdateInBackgroundFunc = func() bool { return true }
+	RunWithUpdateCheck(mockUpdater)
+	assert.Contains(t, buffer.String(), "DEBUG: The version 1.21.0 has been rolled back, it is only installed with --update")
+	assert.Len(t, mockUpdater.StageUpdateCalls(), 0, "The rolled back version is not installed automatically")
+
+	mockUpdater = setupUpdaterMock("1.20.0", "1.21.0")
+	RunWithUpdateCheck(mockUpdater)
+	assert.Len(t, mockUpdater.DoUpdateCalls(), 1, "The rolled back version is installed by --update")
+
+	mockUpdater = setupUpdaterMock("1.20.0", "1.22.0")
+	mockUpdater.UpdateInBackgroundFunc = func() bool { return true }
+	RunWithUpdateCheck(mockUpdater)
+	assert.Len(t, mockUpdater.StageUpdateCalls(), 1, "A newer version is installed automatically")
+}
+
 func TestShouldUpdate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -100,3 +191,67 @@ func TestShouldUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestGetZipName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		goos   string
+		goarch string
+		want   string
+	}{
+		{"linux", "amd64", "tgf_1.21.0_linux_64-bits.zip"},
+		{"linux", "arm64", "tgf_1.21.0_linux_arm64.zip"},
+		{"darwin", "amd64", "tgf_1.21.0_macOS_64-bits.zip"},
+		{"darwin", "arm64", "tgf_1.21.0_macOS_arm64.zip"},
+		{"windows", "amd64", "tgf_1.21.0_windows_64-bits.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			assert.Equal(t, tt.want, getZipName("1.21.0", tt.goos, tt.goarch))
+		})
+	}
+	assert.Equal(t, "https://server/v1.21.0/tgf_1.21.0_checksums.txt", getChecksumsURL("https://server/v1.21.0/tgf_1.21.0_linux_arm64.zip"))
+}
+
+func TestVerifyUpdateArchive(t *testing.T) {
+	t.Parallel()
+
+	archive := []byte("archive content")
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	encodedKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: must(x509.MarshalPKIXPublicKey(publicKey)).([]byte)}))
+	checksums := fmt.Sprintf("%x  tgf_1.21.0_linux_64-bits.zip\n%x  tgf_1.21.0_linux_arm64.zip\n", sha256.Sum256(archive), sha256.Sum256([]byte("other")))
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(checksums)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.21.0/tgf_1.21.0_checksums.txt", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(checksums)) })
+	mux.HandleFunc("/v1.21.0/tgf_1.21.0_checksums.txt.sig", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(signature)) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name      string
+		file      string
+		publicKey string
+		wantErr   string
+	}{
+		{"Valid", "v1.21.0/tgf_1.21.0_linux_64-bits.zip", "", ""},
+		{"Valid with signature", "v1.21.0/tgf_1.21.0_linux_64-bits.zip", encodedKey, ""},
+		{"Mismatch", "v1.21.0/tgf_1.21.0_linux_arm64.zip", "", "the checksum of tgf_1.21.0_linux_arm64.zip does not match the published one"},
+		{"Not listed", "v1.21.0/tgf_1.21.0_macOS_arm64.zip", "", "tgf_1.21.0_macOS_arm64.zip is not listed in the checksums"},
+		{"No checksums", "v1.20.0/tgf_1.20.0_linux_64-bits.zip", "", "unable to get the checksums " + server.URL + "/v1.20.0/tgf_1.20.0_checksums.txt: HTTP status error 404"},
+		{"Bad signature", "v1.21.0/tgf_1.21.0_linux_64-bits.zip", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: must(x509.MarshalPKIXPublicKey(otherKey)).([]byte)})), "invalid signature of " + server.URL + "/v1.21.0/tgf_1.21.0_checksums.txt: the signature does not match the public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &TGFConfig{UpdatePublicKey: tt.publicKey}
+			err := config.verifyUpdateArchive(server.URL+"/"+tt.file, archive)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
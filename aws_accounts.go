@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fatih/color"
+)
+
+var cachedAwsCallerIdentity *sts.GetCallerIdentityOutput
+
+// getAwsCallerIdentity returns the identity of the current AWS credentials, the result is cached since it is used
+// to guess the maximum role duration and to validate the account targeted by the current folder
+func getAwsCallerIdentity(awsConfig aws.Config) (*sts.GetCallerIdentityOutput, error) {
+	if cachedAwsCallerIdentity != nil {
+		return cachedAwsCallerIdentity, nil
+	}
+	identity, err := sts.NewFromConfig(awsConfig).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+	cachedAwsCallerIdentity = identity
+	return identity, nil
+}
+
+// AwsAccountMismatchError is returned when the current AWS identity doesn't target an account allowed by the configuration
+type AwsAccountMismatchError struct {
+	Reason   string
+	Expected []string
+	Account  string
+	Arn      string
+}
+
+func (e AwsAccountMismatchError) Error() string {
+	details := []string{e.Reason}
+	if len(e.Expected) > 0 {
+		details = append(details, fmt.Sprintf("    expected account: %s", color.GreenString(strings.Join(e.Expected, ", "))))
+	}
+	if e.Account != "" {
+		details = append(details,
+			fmt.Sprintf("    actual account:   %s", color.RedString(e.Account)),
+			fmt.Sprintf("    actual identity:  %s", e.Arn),
+		)
+	}
+	return strings.Join(details, "\n")
+}
+
+// checkAwsAccount ensures that the current AWS identity matches the allowed-aws-accounts and forbidden-aws-accounts settings
+func (config *TGFConfig) checkAwsAccount() error {
+	if len(config.AllowedAwsAccounts) == 0 && len(config.ForbiddenAwsAccounts) == 0 {
+		return nil
+	}
+
+	if cachedAwsConfig == nil {
+		// The account could be forbidden as well as not allowed, so we cannot run without knowing it
+		return AwsAccountMismatchError{
+			Reason:   "Unable to validate the AWS account since tgf is not connected to AWS, refusing to run",
+			Expected: config.AllowedAwsAccounts,
+		}
+	}
+
+	identity, err := getAwsCallerIdentity(*cachedAwsConfig)
+	if err != nil {
+		return fmt.Errorf("unable to validate the AWS account, refusing to run: %w", err)
+	}
+
+	account, arn := aws.ToString(identity.Account), aws.ToString(identity.Arn)
+	log.Debugf("Validating AWS account %s (%s)", account, arn)
+	if listContainsElement(config.ForbiddenAwsAccounts, account) {
+		return AwsAccountMismatchError{
+			Reason:  fmt.Sprintf("AWS account %s is forbidden in this folder, refusing to run", account),
+			Account: account,
+			Arn:     arn,
+		}
+	}
+	if len(config.AllowedAwsAccounts) > 0 && !listContainsElement(config.AllowedAwsAccounts, account) {
+		return AwsAccountMismatchError{
+			Reason:   fmt.Sprintf("AWS account %s is not allowed in this folder, refusing to run", account),
+			Expected: config.AllowedAwsAccounts,
+			Account:  account,
+			Arn:      arn,
+		}
+	}
+	return nil
+}
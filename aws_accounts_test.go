@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAwsAccount(t *testing.T) {
+	defer resetCache()
+
+	identity := &sts.GetCallerIdentityOutput{
+		Account: aws.String("111111111111"),
+		Arn:     aws.String("arn:aws:sts::111111111111:assumed-role/deploy/session"),
+	}
+
+	tests := []struct {
+		name      string
+		connected bool
+		allowed   []string
+		forbidden []string
+		wantErr   string
+	}{
+		{"No restriction", true, nil, nil, ""},
+		{"No restriction and not connected", false, nil, nil, ""},
+		{"Allowed", true, []string{"222222222222", "111111111111"}, nil, ""},
+		{"Not allowed", true, []string{"222222222222"}, nil, "AWS account 111111111111 is not allowed in this folder"},
+		{"Forbidden", true, nil, []string{"111111111111"}, "AWS account 111111111111 is forbidden in this folder"},
+		{"Not forbidden", true, nil, []string{"222222222222"}, ""},
+		{"Allowed but not connected", false, []string{"111111111111"}, nil, "Unable to validate the AWS account"},
+		{"Forbidden but not connected", false, nil, []string{"111111111111"}, "Unable to validate the AWS account"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCache()
+			if tt.connected {
+				cachedAwsConfig = &aws.Config{}
+				cachedAwsCallerIdentity = identity
+			}
+			config := &TGFConfig{AllowedAwsAccounts: tt.allowed, ForbiddenAwsAccounts: tt.forbidden}
+			err := config.checkAwsAccount()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
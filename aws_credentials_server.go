@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Environment variables used by the AWS SDKs to get credentials from a container credentials endpoint
+const (
+	envAwsContainerCredentialsURI   = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	envAwsContainerAuthorization    = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+	awsCredentialsServerPath        = "/tgf/credentials"
+	awsCredentialsServerTokenLength = 32
+)
+
+// awsCredentialsServer serves the credentials of a refreshable AWS credentials provider through an endpoint
+// compatible with the ECS container credentials provider. This allows long running commands to get new
+// credentials when the initial ones expire.
+type awsCredentialsServer struct {
+	provider aws.CredentialsProvider
+	token    string
+	listener net.Listener
+	server   *http.Server
+}
+
+// awsCredentialsResponse is the payload expected by the AWS SDKs from a container credentials endpoint
+type awsCredentialsResponse struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+type awsCredentialsErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// startAwsCredentialsServer starts serving credentials on a random loopback port (the AWS SDKs only accept loopback hosts)
+func startAwsCredentialsServer(provider aws.CredentialsProvider) (*awsCredentialsServer, error) {
+	token := make([]byte, awsCredentialsServerTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsServer := &awsCredentialsServer{
+		provider: provider,
+		token:    hex.EncodeToString(token),
+		listener: listener,
+	}
+	mux := http.NewServeMux()
+	mux.Handle(awsCredentialsServerPath, credentialsServer)
+	credentialsServer.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := credentialsServer.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorln("AWS credentials server stopped unexpectedly:", err)
+		}
+	}()
+	log.Debugf("Serving AWS credentials on %s", credentialsServer.URL())
+	return credentialsServer, nil
+}
+
+// URL returns the address that should be used as AWS_CONTAINER_CREDENTIALS_FULL_URI
+func (s *awsCredentialsServer) URL() string {
+	return fmt.Sprintf("http://%s%s", s.listener.Addr().String(), awsCredentialsServerPath)
+}
+
+// Environment returns the environment variables required by the AWS SDKs to use the server
+func (s *awsCredentialsServer) Environment() map[string]string {
+	return map[string]string{
+		envAwsContainerCredentialsURI: s.URL(),
+		envAwsContainerAuthorization:  s.token,
+	}
+}
+
+// Close stops the server
+func (s *awsCredentialsServer) Close() error {
+	return s.server.Close()
+}
+
+func (s *awsCredentialsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != s.token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(awsCredentialsErrorResponse{Code: "AccessDenied", Message: "Invalid authorization token"})
+		return
+	}
+
+	creds, err := s.provider.Retrieve(r.Context())
+	if err != nil {
+		log.Errorln("Unable to refresh the AWS credentials served to the container:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(awsCredentialsErrorResponse{Code: "CredentialsError", Message: err.Error()})
+		return
+	}
+
+	response := awsCredentialsResponse{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+	}
+	if creds.CanExpire {
+		response.Expiration = creds.Expires.UTC().Format(time.RFC3339)
+	}
+	log.Debugf("Serving AWS credentials %s to the container (expires in %s)", creds.AccessKeyID, time.Until(creds.Expires).Round(time.Second))
+	json.NewEncoder(w).Encode(response)
+}
+
+// startAwsCredentialsServerIfEnabled replaces the static AWS credentials injected by InitAWS with a credentials endpoint
+// and returns the arguments that must be added to the docker command. The returned function must be called to stop the server.
+func (config *TGFConfig) startAwsCredentialsServerIfEnabled(dockerArgs []string) ([]string, func()) {
+	app := config.tgf
+	enabled := config.AwsCredentialsServer
+	if app.CredentialsServerSet {
+		enabled = app.CredentialsServer
+	}
+	if !enabled || cachedAwsConfig == nil {
+		return nil, func() {}
+	}
+
+	// The AWS SDKs only accept a loopback address as AWS_CONTAINER_CREDENTIALS_FULL_URI, so the container must share
+	// the network of the host (not possible with Docker Desktop on macOS and Windows)
+	if !dockerHostNetworkReachesLoopback {
+		warnStaticAwsCredentials("the docker host network does not reach the host loopback on " + runtime.GOOS)
+		return nil, func() {}
+	}
+	for _, arg := range dockerArgs {
+		if strings.HasPrefix(arg, "--net") {
+			warnStaticAwsCredentials("a custom docker network is specified (" + arg + ")")
+			return nil, func() {}
+		}
+	}
+
+	server, err := startAwsCredentialsServer(cachedAwsConfig.Credentials)
+	if err != nil {
+		warnStaticAwsCredentials(fmt.Sprintf("it cannot be started (%v)", err))
+		return nil, func() {}
+	}
+
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		delete(config.Environment, key)
+		os.Unsetenv(key)
+	}
+	for key, value := range server.Environment() {
+		config.Environment[key] = value
+	}
+	return []string{"--network", "host"}, func() {
+		if err := server.Close(); err != nil {
+			log.Debugln("Error while stopping the AWS credentials server:", err)
+		}
+	}
+}
+
+// warnStaticAwsCredentials tells the user that the credentials server is not used and when the injected credentials expire
+func warnStaticAwsCredentials(reason string) {
+	expiration := " with the AWS session"
+	if creds, err := cachedAwsConfig.Credentials.Retrieve(context.TODO()); err == nil && creds.CanExpire {
+		expiration = fmt.Sprintf(" at %s", creds.Expires.Local().Format(time.Kitchen))
+	}
+	log.Warningf("The AWS credentials server is not used since %s, the static credentials injected in the container expire%s",
+		reason, expiration)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsCredentialsServer(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	var calls int32
+	server, err := startAwsCredentialsServer(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return aws.Credentials{}, errors.New("expired")
+		}
+		return aws.Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			SessionToken:    "TOKEN",
+			CanExpire:       true,
+			Expires:         expires,
+		}, nil
+	}))
+	assert.NoError(t, err)
+	defer server.Close()
+
+	get := func(token string) *http.Response {
+		request, _ := http.NewRequest(http.MethodGet, server.URL(), nil)
+		request.Header.Set("Authorization", token)
+		response, err := http.DefaultClient.Do(request)
+		assert.NoError(t, err)
+		return response
+	}
+
+	response := get("invalid")
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls), "Credentials must not be retrieved without a valid token")
+
+	response = get(server.Environment()[envAwsContainerAuthorization])
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var credentials awsCredentialsResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&credentials))
+	assert.Equal(t, awsCredentialsResponse{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Token:           "TOKEN",
+		Expiration:      expires.UTC().Format(time.RFC3339),
+	}, credentials)
+
+	response = get(server.Environment()[envAwsContainerAuthorization])
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidcTypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/fatih/color"
+)
+
+const (
+	// We consider a SSO token as expired a few minutes before its actual expiration to avoid starting a command that would fail
+	ssoTokenExpirationMargin = 5 * time.Minute
+	ssoDeviceCodeGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	ssoClientName            = "tgf"
+)
+
+// awsSSOToken represents the content of a SSO token cache file (~/.aws/sso/cache/<hash>.json) as written by the AWS CLI
+type awsSSOToken struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+	Region      string `json:"region,omitempty"`
+	StartURL    string `json:"startUrl,omitempty"`
+}
+
+func (token awsSSOToken) isValid() bool {
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	return err == nil && token.AccessToken != "" && time.Until(expiresAt) > ssoTokenExpirationMargin
+}
+
+// prepareAwsProfile inspects the AWS profile that will be used before trying to retrieve credentials.
+// SSO profiles are logged in through the device authorization flow if their token is missing or expired
+// and credential_process profiles are validated to make sure that the process can actually be launched.
+func (config *TGFConfig) prepareAwsProfile() error {
+	if config.getAwsProfile() == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		// Credentials from the environment have precedence over any profile
+		return nil
+	}
+
+	profileName := getPrettyAwsProfileName(*config)
+	profile, err := awsConfig.LoadSharedConfigProfile(context.TODO(), profileName)
+	if err != nil {
+		// The profile may not exist (i.e. when running on EC2), we let the SDK resolve the credentials by itself
+		log.Debugf("Unable to inspect AWS profile %s: %v", profileName, err)
+		return nil
+	}
+
+	// The credentials are provided by the last profile of the source_profile chain
+	source := &profile
+	for source.Source != nil {
+		source = source.Source
+	}
+
+	switch {
+	case source.SSOSession != nil || source.SSOStartURL != "":
+		return config.ensureAwsSSOToken(profileName, *source)
+	case source.CredentialProcess != "":
+		return checkAwsCredentialProcess(profileName, source.CredentialProcess)
+	}
+	return nil
+}
+
+// ensureAwsSSOToken checks if there is a valid SSO token for the profile and logs in if there is none
+func (config *TGFConfig) ensureAwsSSOToken(profileName string, profile awsConfig.SharedConfig) error {
+	startURL, region := profile.SSOStartURL, profile.SSORegion
+	cacheKeys := []string{startURL}
+	if profile.SSOSession != nil {
+		// The AWS CLI v2 caches the tokens by session name, the legacy format is keyed by start URL
+		startURL, region = profile.SSOSession.SSOStartURL, profile.SSOSession.SSORegion
+		cacheKeys = []string{profile.SSOSession.Name, startURL}
+	}
+
+	for _, key := range cacheKeys {
+		if token, err := loadAwsSSOToken(key); err == nil && token.isValid() {
+			log.Debugf("Using cached AWS SSO token for %s (expires at %s)", startURL, token.ExpiresAt)
+			return nil
+		}
+	}
+
+	if !config.tgf.AwsSSOLogin {
+		return fmt.Errorf("the AWS SSO session of profile %[1]s is expired or missing, run `aws sso login --profile %[1]s` to refresh it", profileName)
+	}
+
+	log.Warningf("The AWS SSO session of profile %s is expired or missing, starting a new login", profileName)
+	token, err := awsSSODeviceLogin(startURL, region)
+	if err != nil {
+		return fmt.Errorf("unable to login to AWS SSO for profile %s: %w\nYou can also run `aws sso login --profile %s` to login manually", profileName, err, profileName)
+	}
+
+	for _, key := range cacheKeys {
+		if err := storeAwsSSOToken(key, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// awsSSODeviceLogin performs the OIDC device authorization flow (the same flow used by `aws sso login`)
+func awsSSODeviceLogin(startURL, region string) (*awsSSOToken, error) {
+	ctx := context.TODO()
+	svc := ssooidc.NewFromConfig(aws.Config{Region: region, Logger: awsLogger})
+
+	client, err := svc.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(ssoClientName),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authorization, err := svc.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     client.ClientId,
+		ClientSecret: client.ClientSecret,
+		StartUrl:     aws.String(startURL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "To sign in to AWS SSO, open the following URL in your browser:\n\n    %s\n\nThen, make sure that the displayed code is %s\n\n",
+		color.HiBlueString(aws.ToString(authorization.VerificationUriComplete)),
+		color.HiYellowString(aws.ToString(authorization.UserCode)),
+	)
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		result, err := svc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     client.ClientId,
+			ClientSecret: client.ClientSecret,
+			DeviceCode:   authorization.DeviceCode,
+			GrantType:    aws.String(ssoDeviceCodeGrantType),
+		})
+
+		var pending *ssooidcTypes.AuthorizationPendingException
+		var slowDown *ssooidcTypes.SlowDownException
+		switch {
+		case err == nil:
+			log.Info("Successfully logged in to AWS SSO")
+			return &awsSSOToken{
+				AccessToken: aws.ToString(result.AccessToken),
+				ExpiresAt:   time.Now().Add(time.Duration(result.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+				Region:      region,
+				StartURL:    startURL,
+			}, nil
+		case errors.As(err, &pending):
+			// The user has not yet approved the request
+		case errors.As(err, &slowDown):
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+	}
+	return nil, errors.New("the device authorization request expired before being approved")
+}
+
+func loadAwsSSOToken(key string) (token awsSSOToken, err error) {
+	filename, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &token)
+	return
+}
+
+func storeAwsSSOToken(key string, token *awsSSOToken) error {
+	filename, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0600)
+}
+
+// checkAwsCredentialProcess ensures that the program configured as credential_process is available
+func checkAwsCredentialProcess(profileName, process string) error {
+	program := strings.TrimSpace(process)
+	if strings.HasPrefix(program, `"`) {
+		program = strings.SplitN(program[1:], `"`, 2)[0]
+	} else if fields := strings.Fields(program); len(fields) > 0 {
+		program = fields[0]
+	}
+	if program == "" {
+		return fmt.Errorf("the credential_process of AWS profile %s is empty", profileName)
+	}
+
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("the credential_process of AWS profile %s cannot be executed (%s): %w", profileName, program, err)
+	}
+	log.Debugf("AWS profile %s gets its credentials from process %s", profileName, program)
+	return nil
+}
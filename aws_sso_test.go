@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsSSOTokenIsValid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		token awsSSOToken
+		want  bool
+	}{
+		{"Empty", awsSSOToken{}, false},
+		{"Valid", awsSSOToken{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}, true},
+		{"Expired", awsSSOToken{AccessToken: "token", ExpiresAt: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)}, false},
+		{"Expires soon", awsSSOToken{AccessToken: "token", ExpiresAt: time.Now().Add(time.Minute).UTC().Format(time.RFC3339)}, false},
+		{"Invalid date", awsSSOToken{AccessToken: "token", ExpiresAt: "2020-01-01 00:00:00 UTC"}, false},
+		{"No access token", awsSSOToken{ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.token.isValid())
+		})
+	}
+}
+
+func TestCheckAwsCredentialProcess(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, checkAwsCredentialProcess("test", "go version"))
+	assert.NoError(t, checkAwsCredentialProcess("test", `"go" env GOPATH`))
+	assert.Error(t, checkAwsCredentialProcess("test", "this-program-does-not-exist --profile test"))
+	assert.EqualError(t, checkAwsCredentialProcess("test", "   "), "the credential_process of AWS profile test is empty")
+	assert.Error(t, checkAwsCredentialProcess("test", `"" --profile test`))
+}
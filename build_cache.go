@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// getBuildCacheImage returns the reference of a build in the docker-image-build-cache repository (empty if there is no cache).
+// The tag includes the platform of the build since the hash only includes it when it is explicitly set.
+func (docker *dockerConfig) getBuildCacheImage(ib TGFConfigBuild) string {
+	if docker.ImageBuildCache == "" {
+		return ""
+	}
+	platform := ib.Platform
+	if platform == "" {
+		platform = getHostPlatform()
+	}
+	platform = strings.ToLower(strings.NewReplacer("/", "-", ":", "-").Replace(platform))
+	return fmt.Sprintf("%s:%s-%s", getImageRepository(docker.ImageBuildCache), platform, ib.hash())
+}
+
+// runRegistryCommand runs a docker command accessing the registry of the image, the login to ECR is done if required
+func (docker *dockerConfig) runRegistryCommand(image string, args ...string) error {
+	for try := 0; ; try++ {
+		var stderr bytes.Buffer
+		cmd := exec.Command("docker", args...)
+		cmd.Stderr = &stderr
+		log.Debug(color.HiBlackString(strings.Join(cmd.Args, " ")))
+		if err := cmd.Run(); err == nil {
+			return nil
+		} else if try == 0 && reECR.MatchString(image) && docker.awsConfigExist() {
+			log.Debugf("Failed to access %v. It is an ECR image, trying again after login to AWS ECR.", image)
+			if err := docker.tryLoginToECR(image); err != nil {
+				return err
+			}
+		} else if stderr.Len() > 0 {
+			return fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(stderr.String()))
+		} else {
+			return err
+		}
+	}
+}
+
+// pullBuildCache retrieves the build from the cache and tags it with the image name, it returns false if the build
+// is not available
+func (docker *dockerConfig) pullBuildCache(name string, ib TGFConfigBuild) bool {
+	cacheImage := docker.getBuildCacheImage(ib)
+	if cacheImage == "" || docker.tgf.skipOffline("the docker image build cache is not used") {
+		return false
+	}
+	if err := docker.runRegistryCommand(cacheImage, "pull", "--quiet", cacheImage); err != nil {
+		log.Debugf("The build of %s is not available in the cache: %v", name, err)
+		return false
+	}
+	defer untagImage(cacheImage)
+	if err := exec.Command("docker", "tag", cacheImage, name).Run(); err != nil {
+		log.Warningf("Unable to tag %s as %s: %v", cacheImage, name, err)
+		return false
+	}
+	log.Debugf("Using %s from the build cache %s", name, cacheImage)
+	return true
+}
+
+// pushBuildCache shares the build through the cache, a failure does not prevent the execution
+func (docker *dockerConfig) pushBuildCache(name string, ib TGFConfigBuild) {
+	cacheImage := docker.getBuildCacheImage(ib)
+	if cacheImage == "" || docker.tgf.skipOffline("the docker image build cache is not used") {
+		return
+	}
+	if err := exec.Command("docker", "tag", name, cacheImage).Run(); err != nil {
+		log.Warningf("Unable to tag %s as %s: %v", name, cacheImage, err)
+		return
+	}
+	defer untagImage(cacheImage)
+	if err := docker.runRegistryCommand(cacheImage, "push", "--quiet", cacheImage); err != nil {
+		log.Warningf("Unable to push %s to the build cache: %v", name, err)
+		return
+	}
+	log.Debugf("Pushed %s to the build cache %s", name, cacheImage)
+}
+
+// untagImage removes a tag, the image is kept since it is also referenced by another tag
+func untagImage(image string) {
+	if err := exec.Command("docker", "rmi", image).Run(); err != nil {
+		log.Debugf("Unable to remove the tag %s: %v", image, err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBuildCacheImage(t *testing.T) {
+	t.Parallel()
+
+	build := TGFConfigBuild{Instructions: "RUN ls"}
+	hash := build.hash()
+	host := strings.Replace(getHostPlatform(), "/", "-", 1)
+	tests := []struct {
+		name     string
+		cache    string
+		platform string
+		want     string
+	}{
+		{"No cache", "", "", ""},
+		{"Repository", "registry.company.com/tgf-cache", "", "registry.company.com/tgf-cache:" + host + "-" + hash},
+		{"Tag is ignored", "registry.company.com/tgf-cache:latest", "", "registry.company.com/tgf-cache:" + host + "-" + hash},
+		{"ECR", "123456789012.dkr.ecr.us-east-1.amazonaws.com/tgf-cache", "", "123456789012.dkr.ecr.us-east-1.amazonaws.com/tgf-cache:" + host + "-" + hash},
+		{"Platform", "registry.company.com/tgf-cache", "linux/arm/v7", "registry.company.com/tgf-cache:linux-arm-v7-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := dockerConfig{&TGFConfig{ImageBuildCache: tt.cache}}
+			build := build
+			build.Platform = tt.platform
+			want := tt.want
+			if tt.platform != "" {
+				want += build.hash()
+			}
+			assert.Equal(t, want, docker.getBuildCacheImage(build))
+		})
+	}
+
+}
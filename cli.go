@@ -6,6 +6,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/coveooss/gotemplate/v3/hcl"
 	"github.com/coveooss/gotemplate/v3/template"
@@ -85,6 +86,7 @@ const (
 type TGFApplication struct {
 	*kingpin.Application
 	AwsProfile           string
+	AwsSSOLogin          bool
 	ConfigFiles          string
 	ConfigLocation       string
 	ConfigDump           bool
@@ -114,6 +116,18 @@ type TGFApplication struct {
 	WithDockerMount      bool
 	AutoUpdate           bool
 	AutoUpdateSet        bool
+	CredentialsServer    bool
+	CredentialsServerSet bool
+	Yes                  bool
+	LockImages           bool
+	Offline              bool
+	PruneKeep            int
+	PruneOlderThan       time.Duration
+	PruneVolumes         bool
+	DryRun               bool
+	Rollback             bool
+
+	completionWords []string // Words to complete (set when tgf is called by a completion script)
 }
 
 // NewTGFApplication returns an initialized copy of TGFApplication along with the parsed CLI arguments
@@ -135,6 +149,7 @@ func NewTGFApplication(args []string) *TGFApplication {
 	app.Flag("image-version", "Use a different version of docker image instead of the default one").PlaceHolder("version").Default("-").StringVar(&app.ImageVersion)
 	app.Flag("tag", "Use a different tag of docker image instead of the default one").Short('T').NoAutoShortcut().PlaceHolder("latest").Default("-").StringVar(&app.ImageTag)
 	app.Flag("local-image", "If set, TGF will not pull the image when refreshing").BoolVar(&app.UseLocalImage)
+	app.Flag("offline", "Do not access the network, only local images and cached configurations are used").NoAutoShortcut().BoolVar(&app.Offline)
 	app.Flag("get-image-name", "Just return the resulting image name").Alias("gi").BoolVar(&app.GetImageName)
 	app.Flag("refresh-image", "Force a refresh of the docker image").BoolVar(&app.Refresh)
 	app.Flag("entrypoint", "Override the entry point for docker").Short('E').PlaceHolder("terragrunt").StringVar(&app.Entrypoint)
@@ -157,17 +172,28 @@ func NewTGFApplication(args []string) *TGFApplication {
 		EnumVar((*string)(&tempLocation), string(mountLocVolume), string(mountLocHost), string(mountLocNone))
 	app.Flag("mount-point", "Specify a mount point for the current folder").PlaceHolder("<folder>").Default("current_sources").StringVar(&app.MountPoint)
 	app.Flag("prune", "Remove all previous versions of the targeted image").BoolVar(&app.PruneImages)
+	app.Flag("keep", "With --prune, number of most recent image versions to keep").NoAutoShortcut().PlaceHolder("N").IntVar(&app.PruneKeep)
+	app.Flag("older-than", "With --prune, only remove images and volumes created before this delay (i.e. 720h)").NoAutoShortcut().PlaceHolder("<delay>").DurationVar(&app.PruneOlderThan)
+	app.Flag("prune-volumes", "With --prune, also remove the tgf docker volumes (home and cache)").NoAutoShortcut().BoolVar(&app.PruneVolumes)
+	app.Flag("dry-run", "With --prune, list what would be removed without removing anything").NoAutoShortcut().BoolVar(&app.DryRun)
+	app.Flag("lock", "Pin the digest of the targeted image in the "+lockFile+" file").BoolVar(&app.LockImages)
 	app.Flag("docker-arg", "Supply extra argument to Docker").PlaceHolder("<opt>").StringsVar(&app.DockerOptions)
 	app.Flag("with-current-user", "Runs the docker command with the current user, using the --user arg").Alias("cu").BoolVar(&app.WithCurrentUser)
 	app.Flag("with-docker-mount", "Mounts the docker socket to the image so the host's docker api is usable").Alias("wd", "dm").BoolVar(&app.WithDockerMount)
 	app.Flag("ignore-user-config", "Ignore all tgf.user.config files").Alias("iu", "iuc").NoAutoShortcut().BoolVar(&app.DisableUserConfig)
 	swFlagON("aws", "Use AWS Parameter store to get configuration").BoolVar(&app.UseAWS)
 	app.Flag("profile", "Set the AWS profile configuration to use").Short('P').NoAutoShortcut().PlaceHolder("<AWS profile>").StringVar(&app.AwsProfile)
+	swFlagON("sso-login", "Automatically login to AWS SSO when the session of the AWS profile is expired").BoolVar(&app.AwsSSOLogin)
+	app.Flag("aws-credentials-server", "Serve refreshable AWS credentials to the container instead of injecting static credentials").IsSetByUser(&app.CredentialsServerSet).BoolVar(&app.CredentialsServer)
 	app.Flag("ssm-path", "Parameter Store path used to find AWS common configuration shared by a team").PlaceHolder("<path>").Default(defaultSSMParameterFolder).StringVar(&app.PsPath)
 	app.Flag("config-files", "Set the files to look for (default: "+remoteDefaultConfigPath+")").PlaceHolder("<files>").StringVar(&app.ConfigFiles)
 	app.Flag("config-location", "Set the configuration location").PlaceHolder("<path>").StringVar(&app.ConfigLocation)
 	app.Flag("config-dump", "Print the TGF configuration and exit").BoolVar(&app.ConfigDump)
+	app.Flag("yes", "Do not ask for confirmation before running a protected command").NoAutoShortcut().BoolVar(&app.Yes)
 	app.Flag("update", "Run auto update script").IsSetByUser(&app.AutoUpdateSet).BoolVar(&app.AutoUpdate)
+	app.Flag("rollback", "Restore the version of tgf replaced by the last update").NoAutoShortcut().BoolVar(&app.Rollback)
+
+	app.addCompletionFlags()
 
 	kingpin.CommandLine = app.Application
 	kingpin.HelpFlag = app.GetFlag("help-tgf")
@@ -235,6 +261,12 @@ func formatDescription() string {
 
 // Parse overrides the base Parse method
 func (app *TGFApplication) Parse(args []string) (command string, err error) {
+	if len(args) > 0 && args[0] == completionArg {
+		// The arguments are incomplete, they are not parsed
+		app.completionWords = append([]string{}, args[1:]...)
+		return
+	}
+
 	// Add args from the TGF_ARGS env variable
 	if extraArgs, ok := os.LookupEnv(envArgs); ok {
 		nonEmptyArgs := []string{}
@@ -268,11 +300,19 @@ func (app *TGFApplication) ShowHelp(c *kingpin.ParseContext) error {
 	}
 	// The default rendering insert unwanted blank line in the argument description
 	fmt.Print(regexp.MustCompile(`:\n +\n`).ReplaceAllString(usageBuffer.String(), ":\n"))
+	// The aliases are listed after the flags
+	fmt.Print(app.loadAliases().aliasesUsage())
 	os.Exit(0)
 	return nil
 }
 
 // Run execute the application
 func (app *TGFApplication) Run() int {
+	if app.completionWords != nil {
+		return app.runCompletion()
+	}
+	if app.Rollback {
+		return Rollback()
+	}
 	return RunWithUpdateCheck(InitConfig(app))
 }
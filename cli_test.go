@@ -154,7 +154,7 @@ func TestNewApplicationWithOptionsAndAliases(t *testing.T) {
 				app := NewTestApplication(tt.args, false)
 				config := &TGFConfig{
 					tgf: app,
-					Aliases: map[string]string{
+					Aliases: map[string]interface{}{
 						"my_alias":           "--ri --li --stuff3",
 						"my_recursive_alias": "my_alias --with-docker-mount",
 					},
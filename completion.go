@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coveord/kingpin/v2"
+)
+
+// The hidden argument used by the completion scripts to get the completions of the words following tgf
+const completionArg = "--completion-bash"
+
+// Commands of the entry points completed after tgf (the ones with subcommands are listed in terraformSubcommands)
+var (
+	terraformCommands = []string{
+		"apply", "console", "destroy", "fmt", "force-unlock", "get", "graph", "import", "init", "login", "logout",
+		"output", "plan", "providers", "refresh", "show", "state", "taint", "test", "untaint", "validate", "version",
+		"workspace",
+	}
+	terragruntCommands = []string{
+		"apply-all", "aws-provider-patch", "destroy-all", "graph-dependencies", "hclfmt", "output-all", "plan-all",
+		"render-json", "run-all", "terragrunt-info", "validate-all", "validate-inputs",
+	}
+	terraformSubcommands = map[string][]string{
+		"providers": {"lock", "mirror", "schema"},
+		"state":     {"list", "mv", "pull", "push", "replace-provider", "rm", "show"},
+		"workspace": {"delete", "list", "new", "select", "show"},
+	}
+)
+
+var completionScripts = map[string]string{
+	"bash": `
+_tgf_completion() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local opts=$(${COMP_WORDS[0]} --completion-bash "${COMP_WORDS[@]:1:$COMP_CWORD}")
+    COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+}
+complete -F _tgf_completion -o default tgf
+`,
+	"zsh": `#compdef tgf
+
+_tgf() {
+    local matches=($(${words[1]} --completion-bash "${(@)words[2,$CURRENT]}"))
+    compadd -a matches
+
+    if [[ $compstate[nmatches] -eq 0 && $words[$CURRENT] != -* ]]; then
+        _files
+    fi
+}
+
+if [[ "$(basename -- ${(%):-%x})" != "_tgf" ]]; then
+    compdef _tgf tgf
+fi
+`,
+	"fish": `
+function __tgf_completion
+    set -l words (commandline -opc) (commandline -ct)
+    tgf --completion-bash $words[2..-1]
+end
+complete -c tgf -a '(__tgf_completion)'
+`,
+	"powershell": `
+Register-ArgumentCompleter -Native -CommandName tgf -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    # Empty arguments are not passed to native commands, a blank one is used instead
+    if ($wordToComplete -eq '') { $words += ' ' }
+    tgf --completion-bash @words | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// addCompletionFlags replaces the kingpin completion flags (they do not handle the unmanaged arguments) by the tgf ones
+func (app *TGFApplication) addCompletionFlags() {
+	_ = app.DeleteFlag("completion-bash")
+	_ = app.DeleteFlag("completion-script-bash")
+	_ = app.DeleteFlag("completion-script-zsh")
+
+	shells := make([]string, 0, len(completionScripts))
+	for shell := range completionScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	for _, shell := range shells {
+		script := completionScripts[shell]
+		app.Flag("completion-script-"+shell, fmt.Sprintf("Generate the completion script for %s", shell)).Hidden().NoAutoShortcut().
+			Action(func(*kingpin.ParseContext) error {
+				fmt.Print(script)
+				os.Exit(0)
+				return nil
+			}).Bool()
+	}
+}
+
+// runCompletion prints the completions of the words following tgf (the last one being the word to complete)
+func (app *TGFApplication) runCompletion() int {
+	config := app.loadAliases()
+	entryPoint := config.EntryPoint
+	if app.Entrypoint != "" {
+		entryPoint = app.Entrypoint
+	}
+	for _, completion := range getCompletions(app.completionWords, app.Model().Flags, config.Aliases, entryPoint) {
+		fmt.Println(completion)
+	}
+	return 0
+}
+
+// getCompletions returns the tgf flags, the aliases and the commands of the entry point matching the last word
+func getCompletions(words []string, flags []*kingpin.FlagModel, aliases map[string]interface{}, entryPoint string) (result []string) {
+	current := ""
+	if len(words) > 0 {
+		current, words = strings.TrimSpace(words[len(words)-1]), words[:len(words)-1]
+	}
+
+	valueFlags := map[string]bool{}
+	for _, flag := range flags {
+		if !flag.IsBoolFlag() {
+			valueFlags["--"+flag.Name] = true
+			if flag.Short != 0 {
+				valueFlags["-"+string(flag.Short)] = true
+			}
+			for _, alias := range flag.Aliases {
+				valueFlags["--"+alias] = true
+			}
+		}
+	}
+
+	var commands []string
+	for i := 0; i < len(words); i++ {
+		switch word := words[i]; {
+		case word == "--":
+		case strings.HasPrefix(word, "-"):
+			if valueFlags[word] {
+				// The next word is the value of the flag
+				i++
+			}
+		default:
+			commands = append(commands, word)
+		}
+	}
+	if len(words) > 0 && valueFlags[words[len(words)-1]] {
+		// The value of a flag is left to the shell
+		return nil
+	}
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(current, "-"):
+		// The aliases and shortcuts of the flags are not proposed to keep the list readable
+		for _, flag := range flags {
+			if flag.Hidden {
+				continue
+			}
+			candidates = append(candidates, "--"+flag.Name)
+			if flag.IsBoolFlag() && len(flag.Default) > 0 && flag.Default[0] == "true" {
+				candidates = append(candidates, "--no-"+flag.Name)
+			}
+		}
+	case len(commands) == 0:
+		for alias := range aliases {
+			candidates = append(candidates, alias)
+		}
+		switch filepath.Base(entryPoint) {
+		case "terragrunt":
+			candidates = append(append(candidates, terraformCommands...), terragruntCommands...)
+		case "terraform":
+			candidates = append(candidates, terraformCommands...)
+		}
+	case len(commands) == 1:
+		if _, isAlias := aliases[commands[0]]; !isAlias {
+			candidates = terraformSubcommands[commands[0]]
+		}
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	return
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCompletions(t *testing.T) {
+	t.Parallel()
+
+	flags := NewTestApplication(nil, false).Model().Flags
+	aliases := map[string]interface{}{"plan-dev": "plan -var env=dev", "st": "state list"}
+
+	tests := []struct {
+		name       string
+		words      []string
+		entryPoint string
+		want       []string
+	}{
+		{"Flags", []string{"--con"}, "terragrunt", []string{"--config-dump", "--config-files", "--config-location"}},
+		{"Negative flags", []string{"--no-aw"}, "terragrunt", []string{"--no-aws"}},
+		{"No shortcuts", []string{"--i"}, "terragrunt", []string{"--ignore-user-config", "--image", "--image-version", "--interactive"}},
+		{"Hidden flags", []string{"--completion"}, "terragrunt", nil},
+		{"Aliases and commands", []string{"pl"}, "terragrunt", []string{"plan", "plan-all", "plan-dev"}},
+		{"Terraform commands only", []string{"pl"}, "/usr/bin/terraform", []string{"plan", "plan-dev"}},
+		{"Other entry point", []string{"pl"}, "bash", []string{"plan-dev"}},
+		{"After flags", []string{"-D", "-L", "debug", "st"}, "terragrunt", []string{"st", "state"}},
+		{"Flag value", []string{"-L", ""}, "terragrunt", nil},
+		{"Subcommands", []string{"state", "m"}, "terragrunt", []string{"mv"}},
+		{"Blank word", []string{"workspace", " "}, "terragrunt", []string{"delete", "list", "new", "select", "show"}},
+		{"After an alias", []string{"st", ""}, "terragrunt", nil},
+		{"Flags after the command", []string{"plan", "--refresh-i"}, "terragrunt", []string{"--refresh-image"}},
+		{"Flag alias value", []string{"--iv", ""}, "terragrunt", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := getCompletions(tt.words, flags, aliases, tt.entryPoint)
+			if len(tt.want) == 0 {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -6,11 +6,9 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
@@ -18,6 +16,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,9 +25,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/blang/semver/v4"
 	"github.com/coveooss/gotemplate/v3/collections"
+	"github.com/docker/docker/pkg/fileutils"
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-getter"
 	"github.com/minio/selfupdate"
@@ -53,26 +54,48 @@ const (
 
 // TGFConfig contains the resulting configuration that will be applied
 type TGFConfig struct {
-	Image                   string            `yaml:"docker-image,omitempty" json:"docker-image,omitempty" hcl:"docker-image,omitempty"`
-	ImageVersion            *string           `yaml:"docker-image-version,omitempty" json:"docker-image-version,omitempty" hcl:"docker-image-version,omitempty"`
-	ImageTag                *string           `yaml:"docker-image-tag,omitempty" json:"docker-image-tag,omitempty" hcl:"docker-image-tag,omitempty"`
-	ImageBuild              string            `yaml:"docker-image-build,omitempty" json:"docker-image-build,omitempty" hcl:"docker-image-build,omitempty"`
-	ImageBuildFolder        string            `yaml:"docker-image-build-folder,omitempty" json:"docker-image-build-folder,omitempty" hcl:"docker-image-build-folder,omitempty"`
-	ImageBuildTag           string            `yaml:"docker-image-build-tag,omitempty" json:"docker-image-build-tag,omitempty" hcl:"docker-image-build-tag,omitempty"`
-	LogLevel                string            `yaml:"logging-level,omitempty" json:"logging-level,omitempty" hcl:"logging-level,omitempty"`
-	EntryPoint              string            `yaml:"entry-point,omitempty" json:"entry-point,omitempty" hcl:"entry-point,omitempty"`
-	Refresh                 time.Duration     `yaml:"docker-refresh,omitempty" json:"docker-refresh,omitempty" hcl:"docker-refresh,omitempty"`
-	DockerOptions           []string          `yaml:"docker-options,omitempty" json:"docker-options,omitempty" hcl:"docker-options,omitempty"`
-	RecommendedImageVersion string            `yaml:"recommended-image-version,omitempty" json:"recommended-image-version,omitempty" hcl:"recommended-image-version,omitempty"`
-	RequiredVersionRange    string            `yaml:"required-image-version,omitempty" json:"required-image-version,omitempty" hcl:"required-image-version,omitempty"`
-	RecommendedTGFVersion   string            `yaml:"tgf-recommended-version,omitempty" json:"tgf-recommended-version,omitempty" hcl:"tgf-recommended-version,omitempty"`
-	Environment             map[string]string `yaml:"environment,omitempty" json:"environment,omitempty" hcl:"environment,omitempty"`
-	RunBefore               string            `yaml:"run-before,omitempty" json:"run-before,omitempty" hcl:"run-before,omitempty"`
-	RunAfter                string            `yaml:"run-after,omitempty" json:"run-after,omitempty" hcl:"run-after,omitempty"`
-	Aliases                 map[string]string `yaml:"alias,omitempty" json:"alias,omitempty" hcl:"alias,omitempty"`
-	UpdateVersion           string            `yaml:"update-version,omitempty" json:"update-version,omitempty" hcl:"update-version,omitempty"`
-	AutoUpdateDelay         time.Duration     `yaml:"auto-update-delay,omitempty" json:"auto-update-delay,omitempty" hcl:"auto-update-delay,omitempty"`
-	AutoUpdate              bool              `yaml:"auto-update,omitempty" json:"auto-update,omitempty" hcl:"auto-update,omitempty"`
+	Image                   string                 `yaml:"docker-image,omitempty" json:"docker-image,omitempty" hcl:"docker-image,omitempty"`
+	ImageVersion            *string                `yaml:"docker-image-version,omitempty" json:"docker-image-version,omitempty" hcl:"docker-image-version,omitempty"`
+	ImageTag                *string                `yaml:"docker-image-tag,omitempty" json:"docker-image-tag,omitempty" hcl:"docker-image-tag,omitempty"`
+	ImageBuild              string                 `yaml:"docker-image-build,omitempty" json:"docker-image-build,omitempty" hcl:"docker-image-build,omitempty"`
+	ImageBuildFolder        string                 `yaml:"docker-image-build-folder,omitempty" json:"docker-image-build-folder,omitempty" hcl:"docker-image-build-folder,omitempty"`
+	ImageBuildTag           string                 `yaml:"docker-image-build-tag,omitempty" json:"docker-image-build-tag,omitempty" hcl:"docker-image-build-tag,omitempty"`
+	ImageBuildKit           bool                   `yaml:"docker-image-build-kit,omitempty" json:"docker-image-build-kit,omitempty" hcl:"docker-image-build-kit,omitempty"`
+	ImageBuildSecrets       []string               `yaml:"docker-image-build-secrets,omitempty" json:"docker-image-build-secrets,omitempty" hcl:"docker-image-build-secrets,omitempty"`
+	ImageBuildSSH           []string               `yaml:"docker-image-build-ssh,omitempty" json:"docker-image-build-ssh,omitempty" hcl:"docker-image-build-ssh,omitempty"`
+	ImageBuildDockerfile    string                 `yaml:"docker-image-build-dockerfile,omitempty" json:"docker-image-build-dockerfile,omitempty" hcl:"docker-image-build-dockerfile,omitempty"`
+	ImageBuildArgs          map[string]string      `yaml:"docker-image-build-args,omitempty" json:"docker-image-build-args,omitempty" hcl:"docker-image-build-args,omitempty"`
+	ImageBuildTarget        string                 `yaml:"docker-image-build-target,omitempty" json:"docker-image-build-target,omitempty" hcl:"docker-image-build-target,omitempty"`
+	ImageBuildPlatform      string                 `yaml:"docker-image-build-platform,omitempty" json:"docker-image-build-platform,omitempty" hcl:"docker-image-build-platform,omitempty"`
+	ImageBuildCache         string                 `yaml:"docker-image-build-cache,omitempty" json:"docker-image-build-cache,omitempty" hcl:"docker-image-build-cache,omitempty"`
+	LogLevel                string                 `yaml:"logging-level,omitempty" json:"logging-level,omitempty" hcl:"logging-level,omitempty"`
+	EntryPoint              string                 `yaml:"entry-point,omitempty" json:"entry-point,omitempty" hcl:"entry-point,omitempty"`
+	Refresh                 time.Duration          `yaml:"docker-refresh,omitempty" json:"docker-refresh,omitempty" hcl:"docker-refresh,omitempty"`
+	DockerOptions           []string               `yaml:"docker-options,omitempty" json:"docker-options,omitempty" hcl:"docker-options,omitempty"`
+	DockerPlatform          string                 `yaml:"docker-platform,omitempty" json:"docker-platform,omitempty" hcl:"docker-platform,omitempty"`
+	RecommendedImageVersion string                 `yaml:"recommended-image-version,omitempty" json:"recommended-image-version,omitempty" hcl:"recommended-image-version,omitempty"`
+	RequiredVersionRange    string                 `yaml:"required-image-version,omitempty" json:"required-image-version,omitempty" hcl:"required-image-version,omitempty"`
+	RecommendedTGFVersion   string                 `yaml:"tgf-recommended-version,omitempty" json:"tgf-recommended-version,omitempty" hcl:"tgf-recommended-version,omitempty"`
+	Environment             map[string]string      `yaml:"environment,omitempty" json:"environment,omitempty" hcl:"environment,omitempty"`
+	RunBefore               string                 `yaml:"run-before,omitempty" json:"run-before,omitempty" hcl:"run-before,omitempty"`
+	RunAfter                string                 `yaml:"run-after,omitempty" json:"run-after,omitempty" hcl:"run-after,omitempty"`
+	Aliases                 map[string]interface{} `yaml:"alias,omitempty" json:"alias,omitempty" hcl:"alias,omitempty"`
+	UpdateVersion           string                 `yaml:"update-version,omitempty" json:"update-version,omitempty" hcl:"update-version,omitempty"`
+	AutoUpdateDelay         time.Duration          `yaml:"auto-update-delay,omitempty" json:"auto-update-delay,omitempty" hcl:"auto-update-delay,omitempty"`
+	AutoUpdate              bool                   `yaml:"auto-update,omitempty" json:"auto-update,omitempty" hcl:"auto-update,omitempty"`
+	UpdateSource            string                 `yaml:"update-source,omitempty" json:"update-source,omitempty" hcl:"update-source,omitempty"`
+	UpdateChannel           string                 `yaml:"update-channel,omitempty" json:"update-channel,omitempty" hcl:"update-channel,omitempty"`
+	UpdatePublicKey         string                 `yaml:"update-public-key,omitempty" json:"update-public-key,omitempty" hcl:"update-public-key,omitempty"`
+	AwsCredentialsServer    bool                   `yaml:"aws-credentials-server,omitempty" json:"aws-credentials-server,omitempty" hcl:"aws-credentials-server,omitempty"`
+	AwsProfile              string                 `yaml:"aws-profile,omitempty" json:"aws-profile,omitempty" hcl:"aws-profile,omitempty"`
+	AwsRoleArn              string                 `yaml:"aws-role-arn,omitempty" json:"aws-role-arn,omitempty" hcl:"aws-role-arn,omitempty"`
+	AwsRegion               string                 `yaml:"aws-region,omitempty" json:"aws-region,omitempty" hcl:"aws-region,omitempty"`
+	AwsExternalID           string                 `yaml:"aws-external-id,omitempty" json:"aws-external-id,omitempty" hcl:"aws-external-id,omitempty"`
+	AllowedAwsAccounts      []string               `yaml:"allowed-aws-accounts,omitempty" json:"allowed-aws-accounts,omitempty" hcl:"allowed-aws-accounts,omitempty"`
+	ForbiddenAwsAccounts    []string               `yaml:"forbidden-aws-accounts,omitempty" json:"forbidden-aws-accounts,omitempty" hcl:"forbidden-aws-accounts,omitempty"`
+	Protected               interface{}            `yaml:"protected,omitempty" json:"protected,omitempty" hcl:"protected,omitempty"`
+	ImageVerify             *ImageVerify           `yaml:"image-verify,omitempty" json:"image-verify,omitempty" hcl:"image-verify,omitempty"`
+	ConfigCacheTTL          time.Duration          `yaml:"config-cache-ttl,omitempty" json:"config-cache-ttl,omitempty" hcl:"config-cache-ttl,omitempty"`
 
 	runBeforeCommands, runAfterCommands []string
 	imageBuildConfigs                   []TGFConfigBuild // List of config built from previous build configs
@@ -84,7 +107,16 @@ type TGFConfigBuild struct {
 	Instructions string
 	Folder       string
 	Tag          string
+	BuildKit     bool
+	Secrets      []string // BuildKit secrets (i.e. id=pip,src=~/.pip/pip.conf)
+	SSH          []string // BuildKit SSH agent sockets or keys to forward (i.e. default)
+	Dockerfile   string   // Existing Dockerfile used instead of the instructions
+	Args         map[string]string
+	Target       string
+	Platform     string
 	source       string
+	base         string // Reference of the base image, included in the hash to rebuild when the base changes
+	computedHash string
 }
 
 var (
@@ -94,19 +126,64 @@ var (
 func resetCache() {
 	cachedAWSConfigExistCheck = nil
 	cachedAwsConfig = nil
+	cachedAwsCallerIdentity = nil
 }
 
+// hash returns a digest of everything that affects the built image: the instructions, the builder settings, the
+// base image and the content of the build folder (excluding the files ignored by .dockerignore)
 func (cb TGFConfigBuild) hash() string {
+	if cb.computedHash != "" {
+		return cb.computedHash
+	}
 	h := md5.New()
 	io.WriteString(h, filepath.Base(filepath.Dir(cb.source)))
 	io.WriteString(h, cb.Instructions)
-	if cb.Folder != "" {
-		filepath.Walk(cb.Dir(), func(path string, info os.FileInfo, err error) error {
-			if info == nil || info.IsDir() || err != nil {
+	if cb.useBuildKit() {
+		// Only added when BuildKit is used to keep the hash of existing builds
+		io.WriteString(h, fmt.Sprintf("buildkit %v %v", cb.Secrets, cb.SSH))
+	}
+	if cb.base != "" {
+		io.WriteString(h, "base "+cb.base)
+	}
+	if cb.Dockerfile != "" {
+		io.WriteString(h, "dockerfile ")
+		if file, err := os.Open(cb.DockerfilePath()); err == nil {
+			io.Copy(h, file)
+			file.Close()
+		}
+	}
+	if args := cb.buildArgValues(); len(args) > 0 {
+		io.WriteString(h, fmt.Sprintf("args %v", args))
+	}
+	if cb.Target != "" || cb.Platform != "" {
+		io.WriteString(h, fmt.Sprintf("target %s platform %s", cb.Target, cb.Platform))
+	}
+	if cb.Folder != "" || cb.Dockerfile != "" {
+		dir := cb.Dir()
+		ignore := loadDockerIgnore(dir)
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if info == nil || err != nil {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return nil
+			}
+			if ignore != nil {
+				if ignored, _ := ignore.Matches(rel); ignored {
+					if info.IsDir() && !ignore.Exclusions() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if info.IsDir() || strings.Contains(path, dockerfilePattern) {
 				return nil
 			}
-			if !strings.Contains(path, dockerfilePattern) {
-				io.WriteString(h, fmt.Sprintf("%v", info.ModTime()))
+			io.WriteString(h, fmt.Sprintf("%s %v\n", filepath.ToSlash(rel), info.Mode().Perm()))
+			if file, err := os.Open(path); err == nil {
+				io.Copy(h, file)
+				file.Close()
 			}
 			return nil
 		})
@@ -114,15 +191,130 @@ func (cb TGFConfigBuild) hash() string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-// Dir returns the folder name relative to the source
+// loadDockerIgnore returns the patterns of the .dockerignore file of the build folder (nil if there is none)
+func loadDockerIgnore(dir string) *fileutils.PatternMatcher {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exclusion := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(filepath.Clean(strings.TrimPrefix(line, "!")), string(filepath.Separator))
+		if exclusion {
+			line = "!" + line
+		}
+		patterns = append(patterns, line)
+	}
+	matcher, err := fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		log.Warningf("Invalid .dockerignore in %s: %v", dir, err)
+		return nil
+	}
+	return matcher
+}
+
+// withBase returns a copy of the build config bound to its base image reference (digest or previous build hash)
+// with its hash computed once
+func (cb TGFConfigBuild) withBase(base string) TGFConfigBuild {
+	cb.base, cb.computedHash = base, ""
+	cb.computedHash = cb.hash()
+	return cb
+}
+
+// useBuildKit returns true if the image must be built with BuildKit (required by secrets and SSH forwarding)
+func (cb TGFConfigBuild) useBuildKit() bool {
+	return cb.BuildKit || len(cb.Secrets) > 0 || len(cb.SSH) > 0
+}
+
+// buildArgs returns the docker build arguments specific to the build config
+func (cb TGFConfigBuild) buildArgs() (args []string) {
+	for _, arg := range cb.buildArgValues() {
+		args = append(args, "--build-arg", arg)
+	}
+	if cb.Target != "" {
+		args = append(args, "--target", cb.Target)
+	}
+	if cb.Platform != "" {
+		args = append(args, "--platform", cb.Platform)
+	}
+	if !cb.useBuildKit() {
+		return append(args, "--force-rm")
+	}
+	for _, secret := range cb.Secrets {
+		args = append(args, "--secret", expandHome(secret))
+	}
+	for _, ssh := range cb.SSH {
+		args = append(args, "--ssh", expandHome(ssh))
+	}
+	return
+}
+
+// buildArgValues returns the sorted build args (key=value), environment variables ($VAR or ${VAR}) are expanded in values
+func (cb TGFConfigBuild) buildArgValues() (result []string) {
+	for key, value := range cb.Args {
+		result = append(result, fmt.Sprintf("%s=%s", key, os.ExpandEnv(value)))
+	}
+	sort.Strings(result)
+	return
+}
+
+// buildEnv returns the environment of the docker build command, the builder is explicitly selected since the
+// default one depends on the docker version
+func (cb TGFConfigBuild) buildEnv() []string {
+	if cb.useBuildKit() {
+		return append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
+	return append(os.Environ(), "DOCKER_BUILDKIT=0")
+}
+
+// expandHome replaces ~ by the home folder in the paths of secret or ssh specifications (i.e. id=pip,src=~/.pip/pip.conf)
+func expandHome(spec string) string {
+	usr, err := user.Current()
+	if err != nil {
+		return spec
+	}
+	return regexp.MustCompile(`(^|[=,])~/`).ReplaceAllString(spec, "${1}"+filepath.ToSlash(usr.HomeDir)+"/")
+}
+
+// Dir returns the folder name relative to the source, the folder of the Dockerfile is used if there is no explicit folder
 func (cb TGFConfigBuild) Dir() string {
 	if cb.Folder == "" {
+		if cb.Dockerfile != "" {
+			return filepath.Dir(cb.DockerfilePath())
+		}
 		return filepath.Dir(cb.source)
 	}
-	if filepath.IsAbs(cb.Folder) {
-		return cb.Folder
+	return cb.relativeToSource(cb.Folder)
+}
+
+// DockerfilePath returns the path of the Dockerfile relative to the source
+func (cb TGFConfigBuild) DockerfilePath() string {
+	if cb.Dockerfile == "" {
+		return ""
 	}
-	return must(filepath.Abs(filepath.Join(filepath.Dir(cb.source), cb.Folder))).(string)
+	return cb.relativeToSource(cb.Dockerfile)
+}
+
+func (cb TGFConfigBuild) relativeToSource(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return must(filepath.Abs(filepath.Join(filepath.Dir(cb.source), path))).(string)
+}
+
+// configID returns an identifier of the configuration file defining the build, it is kept when the build changes and is
+// used to find the builds superseded by a more recent one
+func (cb TGFConfigBuild) configID() string {
+	source := cb.source
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(source)))
 }
 
 // GetTag returns the tag name that should be added to the image
@@ -137,10 +329,18 @@ func (cb TGFConfigBuild) GetTag() string {
 
 // InitConfig returns a properly initialized TGF configuration struct
 func InitConfig(app *TGFApplication) *TGFConfig {
+	config := newConfig(app)
+	config.ParseAliases()
+	return config
+}
+
+// newConfig returns the TGF configuration read from the config files and the parameter store
+func newConfig(app *TGFApplication) *TGFConfig {
 	config := TGFConfig{Image: "coveo/tgf",
 		tgf:               app,
 		Refresh:           1 * time.Hour,
 		AutoUpdateDelay:   2 * time.Hour,
+		ConfigCacheTTL:    5 * time.Minute,
 		AutoUpdate:        true,
 		EntryPoint:        "terragrunt",
 		LogLevel:          "notice",
@@ -148,7 +348,6 @@ func InitConfig(app *TGFApplication) *TGFConfig {
 		imageBuildConfigs: []TGFConfigBuild{},
 	}
 	config.setDefaultValues()
-	config.ParseAliases()
 	return &config
 }
 
@@ -162,19 +361,36 @@ func (config TGFConfig) String() string {
 
 var cachedAwsConfig *aws.Config
 
+// getAwsMFATokenProvider returns a function reading the code of the MFA device from a YubiKey (ykman), the code is
+// asked on stdin if ykman is not installed
+func getAwsMFATokenProvider(serialNumber string) func() (string, error) {
+	if _, err := exec.LookPath("ykman"); err != nil {
+		return stscreds.StdinTokenProvider
+	}
+	return func() (string, error) {
+		fmt.Fprintln(os.Stderr, "Touch your YubiKey...")
+		v, err := exec.Command("ykman", "oath", "accounts", "code", serialNumber, "--single").Output()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to retrieve the OATH code of %s from YubiKey: %v\n", serialNumber, err)
+			return "", err
+		}
+		fmt.Fprintln(os.Stderr, "Successfully retrieved OATH code from YubiKey")
+		return strings.TrimSpace(string(v)), nil
+	}
+}
+
 func (tgfConfig *TGFConfig) loadDefaultConfig(assumeRoleDuration time.Duration) (aws.Config, error) {
 	log.Debugf("Creating new AWS config (assumeRoleDuration=%s)", assumeRoleDuration)
-	return awsConfig.LoadDefaultConfig(
-		context.TODO(),
-		awsConfig.WithSharedConfigProfile(tgfConfig.tgf.AwsProfile),
+	options := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithSharedConfigProfile(tgfConfig.getAwsProfile()),
 		awsConfig.WithLogger(awsLogger),
 		// The logger level controlled by the --aws-debug flag controls whether the logs are shown.
 		// With that in mind, we just let the AWS SDK blindly log and rely on the logger to decide if it should print or not.
 		awsConfig.WithClientLogMode(
-			aws.LogRetries|
-				aws.LogRequestWithBody|
-				aws.LogRequestEventMessage|
-				aws.LogResponseWithBody|
+			aws.LogRetries |
+				aws.LogRequestWithBody |
+				aws.LogRequestEventMessage |
+				aws.LogResponseWithBody |
 				aws.LogResponseEventMessage,
 		),
 		awsConfig.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
@@ -190,7 +406,33 @@ func (tgfConfig *TGFConfig) loadDefaultConfig(assumeRoleDuration time.Duration)
 				o.Duration = assumeRoleDuration
 			}
 		}),
-	)
+	}
+	if tgfConfig.AwsRegion != "" {
+		options = append(options, awsConfig.WithRegion(tgfConfig.AwsRegion))
+	}
+
+	config, err := awsConfig.LoadDefaultConfig(context.TODO(), options...)
+	if err != nil || tgfConfig.AwsRoleArn == "" {
+		return config, err
+	}
+
+	// The role configured in the tgf configuration is assumed from the credentials of the current profile
+	log.Debugf("Assuming role %s", tgfConfig.AwsRoleArn)
+	// The MFA device is the one configured in the profile (mfa_serial) as for the roles assumed by the profile
+	profile, _ := awsConfig.LoadSharedConfigProfile(context.TODO(), getPrettyAwsProfileName(*tgfConfig))
+	config.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(config), tgfConfig.AwsRoleArn, func(o *stscreds.AssumeRoleOptions) {
+		if profile.MFASerial != "" {
+			o.SerialNumber = aws.String(profile.MFASerial)
+			o.TokenProvider = getAwsMFATokenProvider(profile.MFASerial)
+		}
+		if tgfConfig.AwsExternalID != "" {
+			o.ExternalID = aws.String(tgfConfig.AwsExternalID)
+		}
+		if assumeRoleDuration > 0 {
+			o.Duration = assumeRoleDuration
+		}
+	}))
+	return config, nil
 }
 
 func (tgfConfig *TGFConfig) getAwsConfig(assumeRoleDuration time.Duration) (aws.Config, error) {
@@ -246,7 +488,7 @@ func guessAwsMaxAssumeRoleDuration(awsConfig aws.Config) time.Duration {
 
 	roleRegex := regexp.MustCompile(".*:assumed-role/(.*)/.*")
 
-	identity, err := sts.NewFromConfig(awsConfig).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	identity, err := getAwsCallerIdentity(awsConfig)
 	if err != nil {
 		log.Debug("Failed, using fallback:", err)
 		return fallback
@@ -274,8 +516,16 @@ func guessAwsMaxAssumeRoleDuration(awsConfig aws.Config) time.Duration {
 	return maxDuration
 }
 
+// getAwsProfile returns the AWS profile explicitly requested on the command line or in the configuration files
+func (config TGFConfig) getAwsProfile() string {
+	if config.tgf.AwsProfile != "" {
+		return config.tgf.AwsProfile
+	}
+	return config.AwsProfile
+}
+
 func getPrettyAwsProfileName(tgfConfig TGFConfig) string {
-	if profile := tgfConfig.tgf.AwsProfile; profile != "" {
+	if profile := tgfConfig.getAwsProfile(); profile != "" {
 		return profile
 	}
 
@@ -286,14 +536,36 @@ func getPrettyAwsProfileName(tgfConfig TGFConfig) string {
 	return "default"
 }
 
+// setAwsSettings overrides the AWS settings with those defined in the supplied configuration
+func (config *TGFConfig) setAwsSettings(other TGFConfig) {
+	if other.AwsProfile != "" {
+		config.AwsProfile = other.AwsProfile
+	}
+	if other.AwsRoleArn != "" {
+		config.AwsRoleArn = other.AwsRoleArn
+	}
+	if other.AwsRegion != "" {
+		config.AwsRegion = other.AwsRegion
+	}
+	if other.AwsExternalID != "" {
+		config.AwsExternalID = other.AwsExternalID
+	}
+}
+
 // InitAWS tries to open an AWS session and init AWS environment variable on success
 func (config *TGFConfig) InitAWS() error {
-	if config.tgf.AwsProfile == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_PROFILE") != "" {
+	if config.getAwsProfile() == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_PROFILE") != "" {
 		log.Warning("You set both AWS_ACCESS_KEY_ID and AWS_PROFILE, AWS_PROFILE will be ignored")
 	}
+	if config.tgf.AwsProfile != "" && config.AwsProfile != "" && config.tgf.AwsProfile != config.AwsProfile {
+		log.Warningf("Using AWS profile %s instead of %s defined in the configuration", config.tgf.AwsProfile, config.AwsProfile)
+	}
+	if err := config.prepareAwsProfile(); err != nil {
+		return err
+	}
 	awsConfig, err := config.getAwsConfig(0)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to retrieve credentials of AWS profile %s: %w", getPrettyAwsProfileName(*config), err)
 	}
 	creds, err := awsConfig.Credentials.Retrieve(context.TODO())
 	if err != nil {
@@ -339,6 +611,31 @@ func (config *TGFConfig) setDefaultValues() {
 		log.SetStdout(os.Stdout)
 	}
 
+	// Fetch file configs
+	fileConfigsData := []configData{}
+	for _, configFile := range config.findConfigFiles(must(os.Getwd()).(string)) {
+		log.Debugln("Reading configuration from", configFile)
+		bytes, err := ioutil.ReadFile(configFile)
+
+		if err != nil {
+			log.Errorf("Error while loading configuration file %s\n%v", configFile, err)
+			continue
+		}
+		fileConfigsData = append(fileConfigsData, configData{Name: configFile, Raw: string(bytes)})
+	}
+
+	// The AWS settings and the cache delay must be known before fetching the remote configuration, so they are read
+	// from the local configuration files first
+	for _, configData := range fileConfigsData {
+		var fileConfig TGFConfig
+		if err := collections.ConvertData(configData.Raw, &fileConfig); err == nil {
+			config.setAwsSettings(fileConfig)
+			if fileConfig.ConfigCacheTTL != 0 {
+				config.ConfigCacheTTL = fileConfig.ConfigCacheTTL
+			}
+		}
+	}
+
 	// Fetch SSM configs
 	if config.awsConfigExist() {
 		if err := config.InitAWS(); err != nil {
@@ -354,6 +651,15 @@ func (config *TGFConfig) setDefaultValues() {
 		}
 	}
 
+	if app.Offline && app.ConfigLocation == "" {
+		// The parameter store is not reachable, so we use the last known remote configuration location
+		if cached, err := readConfigCache(lastConfigLocationKey); err == nil {
+			app.ConfigLocation, app.ConfigFiles = collections.Split2(cached.Content, "\n")
+		}
+	} else if app.ConfigLocation != "" {
+		writeConfigCache(lastConfigLocationKey, &configCacheEntry{Content: app.ConfigLocation + "\n" + app.ConfigFiles, Fetched: time.Now()})
+	}
+
 	for _, configFile := range config.findRemoteConfigFiles(app.ConfigLocation, app.ConfigFiles) {
 		configsData = append(configsData, configData{Name: "RemoteConfigFile", Raw: configFile})
 	}
@@ -368,17 +674,7 @@ func (config *TGFConfig) setDefaultValues() {
 		}
 	}
 
-	// Fetch file configs
-	for _, configFile := range config.findConfigFiles(must(os.Getwd()).(string)) {
-		log.Debugln("Reading configuration from", configFile)
-		bytes, err := ioutil.ReadFile(configFile)
-
-		if err != nil {
-			log.Errorf("Error while loading configuration file %s\n%v", configFile, err)
-			continue
-		}
-		configsData = append(configsData, configData{Name: configFile, Raw: string(bytes)})
-	}
+	configsData = append(configsData, fileConfigsData...)
 
 	// Parse/Unmarshal configs
 	for i := range configsData {
@@ -396,11 +692,23 @@ func (config *TGFConfig) setDefaultValues() {
 			log.Errorf("Config from %s is nil. It did not load correctly", configData.Name)
 			continue
 		}
-		if configData.Config.ImageBuild != "" {
+		if configData.Config.ImageBuild != "" || configData.Config.ImageBuildDockerfile != "" {
+			instructions := configData.Config.ImageBuild
+			if instructions != "" && configData.Config.ImageBuildDockerfile != "" {
+				log.Warningf("docker-image-build is ignored in %s since docker-image-build-dockerfile is specified", configData.Name)
+				instructions = ""
+			}
 			config.imageBuildConfigs = append([]TGFConfigBuild{{
-				Instructions: configData.Config.ImageBuild,
+				Instructions: instructions,
 				Folder:       configData.Config.ImageBuildFolder,
 				Tag:          configData.Config.ImageBuildTag,
+				BuildKit:     configData.Config.ImageBuildKit,
+				Secrets:      configData.Config.ImageBuildSecrets,
+				SSH:          configData.Config.ImageBuildSSH,
+				Dockerfile:   configData.Config.ImageBuildDockerfile,
+				Args:         configData.Config.ImageBuildArgs,
+				Target:       configData.Config.ImageBuildTarget,
+				Platform:     configData.Config.ImageBuildPlatform,
 				source:       configData.Name,
 			}}, config.imageBuildConfigs...)
 		}
@@ -514,33 +822,6 @@ func (config *TGFConfig) GetImageName() string {
 	return config.Image
 }
 
-// parseAliases will parse the original argument list and replace aliases only in the first argument.
-func (config *TGFConfig) parseAliases(args []string) []string {
-	if len(args) > 0 {
-		if replace := String(config.Aliases[args[0]]); replace != "" {
-			var result collections.StringArray
-			replace, quoted := replace.Protect()
-			result = replace.Fields()
-			if len(quoted) > 0 {
-				for i := range result {
-					result[i] = result[i].RestoreProtected(quoted).ReplaceN(`="`, "=", 1).Trim(`"`)
-				}
-			}
-			return append(config.parseAliases(result.Strings()), args[1:]...)
-		}
-	}
-	return args
-}
-
-// ParseAliases checks if the actual command matches an alias and set the options according to the configuration
-func (config *TGFConfig) ParseAliases() {
-	args := config.tgf.Unmanaged
-	if alias := config.parseAliases(args); len(alias) > 0 && len(args) > 0 && alias[0] != args[0] {
-		config.tgf.Unmanaged = nil
-		must(config.tgf.Application.Parse(alias))
-	}
-}
-
 func (config *TGFConfig) readSSMParameterStore(ssmParameterFolder string) map[string]string {
 	values := make(map[string]string)
 	awsConfig, err := config.getAwsConfig(0)
@@ -549,6 +830,14 @@ func (config *TGFConfig) readSSMParameterStore(ssmParameterFolder string) map[st
 		log.Warningf("Caught an error while creating an AWS session: %v", err)
 		return values
 	}
+
+	cacheKey := fmt.Sprintf("ssm:%s:%s:%s", getPrettyAwsProfileName(*config), awsConfig.Region, ssmParameterFolder)
+	cached, _ := readConfigCache(cacheKey)
+	if cached.isFresh(config.ConfigCacheTTL) && json.Unmarshal([]byte(cached.Content), &values) == nil {
+		log.Debugf("Using the cached SSM parameters of %s", ssmParameterFolder)
+		return values
+	}
+
 	svc := ssm.NewFromConfig(awsConfig)
 	response, err := svc.GetParametersByPath(context.TODO(), &ssm.GetParametersByPathInput{
 		Path:           aws.String(ssmParameterFolder),
@@ -556,12 +845,24 @@ func (config *TGFConfig) readSSMParameterStore(ssmParameterFolder string) map[st
 		WithDecryption: aws.Bool(true),
 	})
 	if err != nil {
+		if cached != nil && json.Unmarshal([]byte(cached.Content), &values) == nil {
+			log.Warningf("Caught an error while reading from `%s` in SSM, using the copy cached at %s: %v", ssmParameterFolder, cached.Fetched.Format(time.RFC3339), err)
+			return values
+		}
 		log.Warningf("Caught an error while reading from `%s` in SSM: %v", ssmParameterFolder, err)
 		return values
 	}
+	// The decrypted SecureString values are never written to disk, the cache is then only used as a fallback
+	persisted := make(map[string]string, len(response.Parameters))
 	for _, parameter := range response.Parameters {
 		key := strings.TrimLeft(strings.Replace(*parameter.Name, ssmParameterFolder, "", 1), "/")
 		values[key] = *parameter.Value
+		if parameter.Type != types.ParameterTypeSecureString {
+			persisted[key] = *parameter.Value
+		}
+	}
+	if content, err := json.Marshal(persisted); err == nil {
+		writeConfigCache(cacheKey, &configCacheEntry{Content: string(content), Fetched: time.Now(), Partial: len(persisted) < len(values)})
 	}
 	return values
 }
@@ -586,30 +887,25 @@ func (config *TGFConfig) findRemoteConfigFiles(location, files string) []string
 	configs := []string{}
 	for _, configPath := range configPaths {
 		fullConfigPath := location + configPath
+		if config.tgf.skipOffline("the remote configuration files are read from the cache") {
+			if cached, err := readConfigCache(fullConfigPath); err != nil {
+				log.Warningf("No cached configuration for %s", fullConfigPath)
+			} else if cached.Content != "" {
+				configs = append(configs, cached.Content)
+			}
+			continue
+		}
 		destConfigPath := path.Join(tempDir, configPath)
 		log.Debugln("Reading configuration from", fullConfigPath)
 		source := must(getter.Detect(fullConfigPath, must(os.Getwd()).(string), getter.Detectors)).(string)
 
-		err := getter.GetFile(destConfigPath, source)
-		if err == nil {
-			_, err = os.Stat(destConfigPath)
-			if os.IsNotExist(err) {
-				err = errors.New("config file was not found at the source")
-			}
-		}
-
+		content, err := config.fetchRemoteConfig(fullConfigPath, source, destConfigPath)
 		if err != nil {
 			log.Warningf("Error fetching config at %s: %v", source, err)
 			continue
 		}
-
-		if content, err := ioutil.ReadFile(destConfigPath); err != nil {
-			log.Warningf("Error reading fetched config file %s: %v", configPath, err)
-		} else {
-			contentString := string(content)
-			if contentString != "" {
-				configs = append(configs, contentString)
-			}
+		if content != "" {
+			configs = append(configs, content)
 		}
 	}
 
@@ -637,7 +933,12 @@ func (config TGFConfig) awsConfigExist() (result bool) {
 	if cachedAWSConfigExistCheck != nil {
 		return *cachedAWSConfigExistCheck
 	}
-	defer func() { cachedAWSConfigExistCheck = &result }()
+	defer func() {
+		if result && config.tgf.skipOffline("the AWS configuration and the parameter store are not used") {
+			result = false
+		}
+		cachedAWSConfigExistCheck = &result
+	}()
 	app := config.tgf
 	if !app.UseAWS {
 		log.Debugln("Not trying to read the config from AWS. It is disabled")
@@ -646,6 +947,11 @@ func (config TGFConfig) awsConfigExist() (result bool) {
 
 	log.Debugln("Checking if the TGF configuration should be read from AWS SSM. This will happen if any of the following are true:")
 
+	if config.AwsProfile != "" || config.AwsRoleArn != "" {
+		log.Debugln(" - The AWS profile or role is defined in the configuration: true")
+		return true
+	}
+
 	environmentVariablesExist := os.Getenv("AWS_PROFILE")+os.Getenv("AWS_ACCESS_KEY_ID")+os.Getenv("AWS_CONFIG_FILE")+os.Getenv("TGF_USE_AWS_CONFIG") != ""
 	log.Debugln(" - One of these env variables exist (AWS_PROFILE, AWS_ACCESS_KEY_ID, AWS_CONFIG_FILE, TGF_USE_AWS_CONFIG):", environmentVariablesExist)
 	if environmentVariablesExist {
@@ -739,37 +1045,19 @@ func (e VersionMistmatchError) Error() string {
 	return string(e)
 }
 
-// Restart re-run the app with all the arguments passed
-func (config *TGFConfig) Restart() int {
-	cmd := exec.Command(os.Args[0], os.Args[1:]...)
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Errorln("Error on restart:", err)
-		return 1
-	}
-	return 0
-}
-
-// GetUpdateVersion fetches the latest tgf version number from the GITHUB_API
+// GetUpdateVersion fetches the latest tgf version number from the update source (GitHub by default)
 func (config *TGFConfig) GetUpdateVersion() (string, error) {
 	if config.UpdateVersion != "" {
 		// The target version number has been specified in the configuration to avoid
 		// hammering GitHub
 		return config.UpdateVersion, nil
 	}
-	resp, err := http.Get("https://api.github.com/repos/coveooss/tgf/releases/latest")
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+	return config.getUpdateSource().getLatestVersion(config.getUpdateChannel())
+}
 
-	var jsonResponse map[string]string
-	json.NewDecoder(resp.Body).Decode(&jsonResponse)
-	latestVersion := jsonResponse["tag_name"]
-	if latestVersion == "" {
-		return "", errors.New("Error parsing json response")
-	}
-	return latestVersion[1:], nil
+// GetUpdateURL returns the url of the tgf archive of the version for the current platform
+func (config *TGFConfig) GetUpdateURL(version string) string {
+	return config.getUpdateSource().getArchiveURL(version)
 }
 
 // ShouldUpdate evaluate wether tgf updater should run or not depending on cli options and config file
@@ -803,22 +1091,19 @@ func (config *TGFConfig) ShouldUpdate() bool {
 		}
 	}
 
+	if app.skipOffline("the check for a newer version of tgf is skipped") {
+		return false
+	}
 	return true
 }
 
 func (config *TGFConfig) getTgfFile(url string) (tgfFile io.ReadCloser, err error) {
 	// request the new zip file
-	resp, err := http.Get(url)
+	body, err := downloadUpdateFile(url)
 	if err != nil {
 		return
-	} else if resp.StatusCode != 200 {
-		err = fmt.Errorf("HTTP status error %v", resp.StatusCode)
-		return
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	if err = config.verifyUpdateArchive(url, body); err != nil {
 		return
 	}
 
@@ -837,17 +1122,47 @@ func (config *TGFConfig) getTgfFile(url string) (tgfFile io.ReadCloser, err erro
 
 // DoUpdate fetch the executable from the link, unzip it and replace it with the current
 func (config *TGFConfig) DoUpdate(url string) (err error) {
-	savePath, err := ioutil.TempFile("", "tgf.previous-version")
+	file, err := config.StageUpdate(url)
 	if err != nil {
 		return
 	}
+	return config.ApplyUpdate(file)
+}
 
+// StageUpdate fetch the executable from the link, verify it and unzip it in a temporary file
+func (config *TGFConfig) StageUpdate(url string) (file string, err error) {
 	tgfFile, err := config.getTgfFile(url)
 	if err != nil {
 		return
 	}
+	defer tgfFile.Close()
+
+	out, err := createStagedFile()
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, tgfFile); err != nil {
+		os.Remove(out.Name())
+		return
+	}
+	return out.Name(), nil
+}
+
+// ApplyUpdate replaces the current executable by the staged one, the current version is kept to allow a rollback
+func (config *TGFConfig) ApplyUpdate(file string) (err error) {
+	defer os.Remove(file)
+	savePath, err := getPreviousVersionPath()
+	if err != nil {
+		return
+	}
+	tgfFile, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer tgfFile.Close()
 
-	if err = selfupdate.Apply(tgfFile, selfupdate.Options{OldSavePath: savePath.Name()}); err != nil {
+	if err = selfupdate.Apply(tgfFile, selfupdate.Options{OldSavePath: savePath}); err != nil {
 		if err := selfupdate.RollbackError(err); err != nil {
 			log.Errorln("Failed to rollback from bad update:", err)
 		}
@@ -855,6 +1170,12 @@ func (config *TGFConfig) DoUpdate(url string) (err error) {
 	return
 }
 
+// UpdateInBackground returns true if the update is automatic (not forced by --update), so it should not delay the
+// command
+func (config *TGFConfig) UpdateInBackground() bool {
+	return !config.tgf.AutoUpdateSet
+}
+
 // GetLastRefresh get the lastime the tgf update file was updated
 func (config *TGFConfig) GetLastRefresh(autoUpdateFile string) time.Duration {
 	return lastRefresh(autoUpdateFile)
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	getter "github.com/hashicorp/go-getter"
+)
+
+// Key of the cache entry containing the last remote configuration location and files
+const lastConfigLocationKey = "last-config-location"
+
+// Timeout of the requests fetching the remote configuration files
+const configHTTPTimeout = 30 * time.Second
+
+// configCacheEntry is a remote configuration (file or SSM values) kept under ~/.tgf/config-cache
+type configCacheEntry struct {
+	Content      string    `json:"content"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Partial      bool      `json:"partial,omitempty"` // Some values (SSM SecureStrings) are not persisted
+}
+
+// getConfigCacheFilename returns the file caching the remote configuration identified by key
+func getConfigCacheFilename(key string) (string, error) {
+	folder, err := getTgfFolder()
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum([]byte(key))
+	return filepath.Join(folder, "config-cache", base64.RawURLEncoding.EncodeToString(hash[:])), nil
+}
+
+// readConfigCache returns the cached remote configuration identified by key
+func readConfigCache(key string) (*configCacheEntry, error) {
+	filename, err := getConfigCacheFilename(key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entry configCacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %w", filename, err)
+	}
+	return &entry, nil
+}
+
+// writeConfigCache keeps a copy of the remote configuration to be used when the source is not reachable.
+// The file is only readable by the current user.
+func writeConfigCache(key string, entry *configCacheEntry) {
+	filename, err := getConfigCacheFilename(key)
+	if err == nil {
+		var content []byte
+		if content, err = json.Marshal(entry); err == nil {
+			if err = os.MkdirAll(filepath.Dir(filename), 0700); err == nil {
+				err = ioutil.WriteFile(filename, content, 0600)
+			}
+		}
+	}
+	if err != nil {
+		log.Debugf("Unable to cache the configuration %s: %v", key, err)
+	}
+}
+
+// isFresh returns true if the entry has been fetched for less than the TTL
+func (entry *configCacheEntry) isFresh(ttl time.Duration) bool {
+	return entry != nil && !entry.Partial && time.Since(entry.Fetched) < ttl
+}
+
+// fetchRemoteConfig returns the content of the remote configuration file. The cached copy is used if it is more recent
+// than config-cache-ttl, or if the source cannot be fetched.
+func (config *TGFConfig) fetchRemoteConfig(key, source, destination string) (string, error) {
+	if strings.HasPrefix(source, "file://") {
+		// Local files are always up to date
+		entry, err := fetchGetterConfig(source, destination, nil)
+		if err != nil {
+			return "", err
+		}
+		return entry.Content, nil
+	}
+
+	cached, _ := readConfigCache(key)
+	if cached.isFresh(config.ConfigCacheTTL) {
+		log.Debugf("Using the cached configuration of %s", key)
+		return cached.Content, nil
+	}
+
+	entry, err := fetchGetterConfig(source, destination, cached)
+	if err != nil {
+		if cached != nil {
+			log.Warningf("Error fetching config at %s, using the copy cached at %s: %v", source, cached.Fetched.Format(time.RFC3339), err)
+			return cached.Content, nil
+		}
+		return "", err
+	}
+	entry.Fetched = time.Now()
+	writeConfigCache(key, entry)
+	return entry.Content, nil
+}
+
+// conditionalTransport revalidates the cached configuration with ETag and Last-Modified. A 304 response is returned to
+// go-getter as the cached content, so all its options (netrc, checksum, archive, etc.) still apply.
+type conditionalTransport struct {
+	cached      *configCacheEntry
+	source      *url.URL
+	response    http.Header
+	notModified bool
+}
+
+func (t *conditionalTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Host != t.source.Host || request.URL.Path != t.source.Path {
+		// Other files such as the checksum are fetched as usual
+		return http.DefaultTransport.RoundTrip(request)
+	}
+	if t.cached != nil {
+		request = request.Clone(request.Context())
+		if t.cached.ETag != "" {
+			request.Header.Set("If-None-Match", t.cached.ETag)
+		}
+		if t.cached.LastModified != "" {
+			request.Header.Set("If-Modified-Since", t.cached.LastModified)
+		}
+	}
+	response, err := http.DefaultTransport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	t.response = response.Header
+	if response.StatusCode == http.StatusNotModified && t.cached != nil {
+		response.Body.Close()
+		t.notModified = true
+		response.StatusCode, response.Status = http.StatusOK, http.StatusText(http.StatusOK)
+		response.Body = ioutil.NopCloser(strings.NewReader(t.cached.Content))
+		response.ContentLength = int64(len(t.cached.Content))
+	}
+	return response, nil
+}
+
+// fetchGetterConfig downloads the configuration file with go-getter (HTTP, S3, git, etc.), the cached entry of HTTP(S)
+// sources is revalidated with ETag and Last-Modified
+func fetchGetterConfig(source, destination string, cached *configCacheEntry) (*configCacheEntry, error) {
+	var options []getter.ClientOption
+	var transport *conditionalTransport
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if sourceURL, err := url.Parse(source); err == nil {
+			transport = &conditionalTransport{cached: cached, source: sourceURL}
+			httpGetter := &getter.HttpGetter{
+				Netrc:               true,
+				DoNotCheckHeadFirst: true,
+				Client:              &http.Client{Timeout: configHTTPTimeout, Transport: transport},
+			}
+			getters := make(map[string]getter.Getter, len(getter.Getters))
+			for scheme, g := range getter.Getters {
+				getters[scheme] = g
+			}
+			getters["http"], getters["https"] = httpGetter, httpGetter
+			options = append(options, getter.WithGetters(getters))
+		}
+	}
+
+	err := getter.GetFile(destination, source, options...)
+	if err == nil {
+		_, err = os.Stat(destination)
+		if os.IsNotExist(err) {
+			err = errors.New("config file was not found at the source")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(destination)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fetched config file %s: %w", destination, err)
+	}
+	entry := &configCacheEntry{Content: string(content)}
+	if transport != nil && transport.response != nil {
+		if transport.notModified {
+			log.Debugf("The configuration at %s has not been modified", source)
+			entry.ETag, entry.LastModified = cached.ETag, cached.LastModified
+		}
+		if etag := transport.response.Get("ETag"); etag != "" {
+			entry.ETag = etag
+		}
+		if lastModified := transport.response.Get("Last-Modified"); lastModified != "" {
+			entry.LastModified = lastModified
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchRemoteConfig(t *testing.T) {
+	var requests, modified int
+	var failing bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case failing:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			modified++
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("docker-image: coveo/remote-tgf"))
+		}
+	}))
+	defer server.Close()
+
+	source := fmt.Sprintf("%s/%d/tgf.config", server.URL, time.Now().UnixNano())
+	config := &TGFConfig{tgf: &TGFApplication{}}
+	fetch := func() string {
+		content, err := config.fetchRemoteConfig(source, source, filepath.Join(t.TempDir(), "tgf.config"))
+		assert.NoError(t, err)
+		return content
+	}
+
+	assert.Equal(t, "docker-image: coveo/remote-tgf", fetch())
+	assert.Equal(t, "docker-image: coveo/remote-tgf", fetch(), "The cached copy is revalidated")
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, modified)
+
+	config.ConfigCacheTTL = time.Hour
+	assert.Equal(t, "docker-image: coveo/remote-tgf", fetch(), "The cached copy is used without request within the TTL")
+	assert.Equal(t, 2, requests)
+
+	config.ConfigCacheTTL = 0
+	failing = true
+	assert.Equal(t, "docker-image: coveo/remote-tgf", fetch(), "The stale copy is used on failure")
+	assert.Equal(t, 3, requests)
+
+	_, err := config.fetchRemoteConfig(source+".other", source+".other", filepath.Join(t.TempDir(), "tgf.config"))
+	assert.Error(t, err, "No cached copy to fall back to")
+}
+
+func TestFetchRemoteConfigGetterOptions(t *testing.T) {
+	const content = "docker-image: coveo/remote-tgf"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	checksum := sha256.Sum256([]byte(content))
+	source := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + fmt.Sprintf("/%d/tgf.config", time.Now().UnixNano())
+	config := &TGFConfig{tgf: &TGFApplication{}}
+
+	result, err := config.fetchRemoteConfig(source, source+"?checksum=sha256:"+hex.EncodeToString(checksum[:]), filepath.Join(t.TempDir(), "tgf.config"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, result, "The credentials and the checksum are handled by go-getter")
+
+	_, err = config.fetchRemoteConfig(source+".other", source+".other?checksum=sha256:0123", filepath.Join(t.TempDir(), "tgf.config"))
+	assert.Error(t, err, "The checksum does not match")
+}
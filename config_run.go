@@ -42,6 +42,18 @@ func (config *TGFConfig) Run() int {
 
 	if app.ConfigDump {
 		fmt.Println(config.String())
+		if len(config.imageBuildConfigs) > 0 {
+			// The digest of the base image is part of the hash, only the local image is used to avoid any side effect
+			docker := dockerConfig{config}
+			if _, baseImage := docker.getBaseImage(); getImageReference(baseImage) == "" {
+				fmt.Printf("# docker-image-build hashes: the base image %s is not available locally\n", baseImage)
+			} else {
+				fmt.Println("# docker-image-build hashes:")
+				for _, build := range config.getBuildConfigs(baseImage) {
+					fmt.Printf("#   %s: %s\n", build.source, build.hash())
+				}
+			}
+		}
 		return 0
 	}
 
@@ -55,8 +67,19 @@ func (config *TGFConfig) Run() int {
 	}
 
 	docker := dockerConfig{config}
-	imageName := config.GetImageName()
-	if lastRefresh(imageName) > config.Refresh || config.IsPartialVersion() || !checkImage(imageName) || app.Refresh {
+	if app.LockImages {
+		configuredName := config.GetImageName()
+		docker.resolveImageVersion()
+		return docker.lockImage(configuredName, config.GetImageName())
+	}
+	imageName := docker.resolveImageName()
+
+	if lockedImageName := getLockedImageName(imageName); lockedImageName != imageName {
+		// A locked image is immutable, so it only has to be pulled once
+		if !checkImage(lockedImageName) {
+			docker.refreshImage(lockedImageName)
+		}
+	} else if lastRefresh(imageName) > config.Refresh || config.IsPartialVersion() || !checkImage(imageName) || app.Refresh || docker.hasWrongPlatform(imageName) {
 		docker.refreshImage(imageName)
 	}
 
@@ -83,5 +106,22 @@ func (config *TGFConfig) Run() int {
 		}
 	}
 
-	return docker.call()
+	if !app.GetImageName {
+		if err := docker.verifyImage(getLockedImageName(imageName)); err != nil {
+			log.Error(err)
+			return 1
+		}
+		if err := config.checkAwsAccount(); err != nil {
+			log.Error(err)
+			return 1
+		}
+		if !config.confirmProtectedCommand() {
+			return 1
+		}
+	}
+
+	notifyImageUpdate := docker.startImageUpdateCheck()
+	exitCode := docker.call()
+	notifyImageUpdate()
+	return exitCode
 }
@@ -4,23 +4,28 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/coveooss/gotemplate/v3/collections"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -124,7 +129,7 @@ func TestSetConfigDefaultValues(t *testing.T) {
 
 	assert.Equal(t, "coveo/stuff", config.Image)
 	assert.Equal(t, "test", *config.ImageTag)
-	assert.Equal(t, map[string]string{"my-alias": "--arg value"}, config.Aliases)
+	assert.Equal(t, map[string]interface{}{"my-alias": "--arg value"}, config.Aliases)
 	assert.Nil(t, config.ImageVersion)
 }
 
@@ -197,6 +202,77 @@ func TestTwoLevelsOfTgfConfig(t *testing.T) {
 	assert.Equal(t, "2.0.2", *config.ImageVersion)
 }
 
+func TestAwsSettingsFromConfigFiles(t *testing.T) {
+	tempDir, _ := filepath.EvalSymlinks(must(ioutil.TempDir("", "TestGetConfig")).(string))
+	currentDir, _ := os.Getwd()
+	subFolder := path.Join(tempDir, "sub-folder")
+	defer func() {
+		assert.NoError(t, os.Chdir(currentDir))
+		assert.NoError(t, os.RemoveAll(tempDir))
+	}()
+	assert.NoError(t, os.Mkdir(subFolder, os.ModePerm))
+	assert.NoError(t, os.Chdir(subFolder))
+
+	parentTgfConfig := []byte(String(`
+	aws-profile: dev
+	aws-region: us-east-1
+	aws-external-id: my-id
+	`).UnIndent().TrimSpace())
+	ioutil.WriteFile(path.Join(tempDir, ".tgf.config"), parentTgfConfig, 0644)
+
+	tgfConfig := []byte(String(`
+	aws-profile: prod
+	aws-role-arn: arn:aws:iam::123456789012:role/deploy
+	`).UnIndent().TrimSpace())
+	ioutil.WriteFile(path.Join(subFolder, ".tgf.config"), tgfConfig, 0644)
+
+	app := NewTestApplication([]string{"--no-aws"}, true)
+	config := InitConfig(app)
+
+	assert.Equal(t, "prod", config.AwsProfile)
+	assert.Equal(t, "prod", config.getAwsProfile())
+	assert.Equal(t, "arn:aws:iam::123456789012:role/deploy", config.AwsRoleArn)
+	assert.Equal(t, "us-east-1", config.AwsRegion)
+	assert.Equal(t, "my-id", config.AwsExternalID)
+
+	app.AwsProfile = "other"
+	assert.Equal(t, "other", config.getAwsProfile(), "The profile specified on the command line has precedence")
+}
+
+func TestAwsMFATokenProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake ykman is a shell script")
+	}
+	folder := t.TempDir()
+	ykman := "#!/bin/sh\n[ \"$4\" = arn:aws:iam::123456789012:mfa/user ] && echo 123456 || exit 1\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(folder, "ykman"), []byte(ykman), 0755))
+	t.Setenv("PATH", folder)
+
+	token, err := getAwsMFATokenProvider("arn:aws:iam::123456789012:mfa/user")()
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", token, "The code is read from the MFA device of the profile")
+
+	_, err = getAwsMFATokenProvider("arn:aws:iam::123456789012:mfa/other")()
+	assert.Error(t, err)
+
+	t.Setenv("PATH", t.TempDir())
+	assert.Equal(t, reflect.ValueOf(stscreds.StdinTokenProvider).Pointer(), reflect.ValueOf(getAwsMFATokenProvider("arn:aws:iam::123456789012:mfa/user")).Pointer(), "The code is asked if ykman is not installed")
+}
+
+func TestRemoteConfigOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("docker-image: coveo/remote-tgf"))
+	}))
+	location := fmt.Sprintf("%s/%d/", server.URL, time.Now().UnixNano())
+	config := &TGFConfig{tgf: &TGFApplication{}}
+	assert.Equal(t, []string{"docker-image: coveo/remote-tgf"}, config.findRemoteConfigFiles(location, "tgf.config"))
+	server.Close()
+
+	config.tgf.Offline = true
+	assert.Equal(t, []string{"docker-image: coveo/remote-tgf"}, config.findRemoteConfigFiles(location, "tgf.config"), "The cached configuration is used offline")
+	assert.Empty(t, config.findRemoteConfigFiles(location, "other.config"), "No cached configuration")
+}
+
 func TestWeirdDirName(t *testing.T) {
 	tempDir, _ := ioutil.TempDir("", "bad@(){}-good-_.1234567890ABC")
 	currentDir, _ := os.Getwd()
@@ -225,38 +301,88 @@ func TestParseAliases(t *testing.T) {
 	t.Parallel()
 
 	config := TGFConfig{
-		Aliases: map[string]string{
+		Aliases: map[string]interface{}{
 			"to_replace": "one two three,four",
 			"other_arg1": "will not be replaced",
 			"with_quote": `quoted arg1 "arg 2" arg3="arg4 arg5" -D -it --rm`,
 			"recursive":  "to_replace five",
+			"positional": "plan -var env=$1 -var-file=$1.tfvars $2",
+			"all_args":   `run-all "$@" --terragrunt-non-interactive`,
+			"in_arg":     "echo --args=$@",
+			"structured": map[string]interface{}{
+				"command":     "apply $1",
+				"description": "Apply a plan",
+				"env":         map[string]interface{}{"TF_LOG": "debug", "TF_IN_AUTOMATION": "1"},
+			},
+			"nested": map[interface{}]interface{}{
+				"command": "structured plan.out -auto-approve",
+				"env":     map[interface{}]interface{}{"TF_LOG": "trace"},
+			},
+			"no_command": map[string]interface{}{"description": "Not an alias"},
 		},
 	}
 
+	var hclConfig TGFConfig
+	assert.NoError(t, collections.ConvertData(`
+alias {
+  pd {
+    command     = "plan -var env=$1"
+    description = "Plan an environment"
+    env {
+      TF_LOG = "debug"
+    }
+  }
+}`, &hclConfig))
+
 	tests := []struct {
-		name   string
-		config TGFConfig
-		args   []string
-		want   []string
+		name    string
+		config  TGFConfig
+		args    []string
+		want    []string
+		wantEnv map[string]string
 	}{
-		{"Nil", config, nil, nil},
-		{"Empty", config, []string{}, []string{}},
-		{"Unchanged", config, strings.Split("whatever the args are", " "), []string{"whatever", "the", "args", "are"}},
-		{"Replaced", config, strings.Split("to_replace with some args", " "), []string{"one", "two", "three,four", "with", "some", "args"}},
-		{"Replaced 2", config, strings.Split("to_replace other_arg1", " "), []string{"one", "two", "three,four", "other_arg1"}},
-		{"Replaced with quote", config, strings.Split("with_quote 1 2 3", " "), []string{"quoted", "arg1", "arg 2", "arg3=arg4 arg5", "-D", "-it", "--rm", "1", "2", "3"}},
-		{"Recursive", config, strings.Split("recursive", " "), []string{"one", "two", "three,four", "five"}},
+		{"Nil", config, nil, nil, nil},
+		{"Empty", config, []string{}, []string{}, nil},
+		{"Unchanged", config, strings.Split("whatever the args are", " "), []string{"whatever", "the", "args", "are"}, nil},
+		{"Replaced", config, strings.Split("to_replace with some args", " "), []string{"one", "two", "three,four", "with", "some", "args"}, nil},
+		{"Replaced 2", config, strings.Split("to_replace other_arg1", " "), []string{"one", "two", "three,four", "other_arg1"}, nil},
+		{"Replaced with quote", config, strings.Split("with_quote 1 2 3", " "), []string{"quoted", "arg1", "arg 2", "arg3=arg4 arg5", "-D", "-it", "--rm", "1", "2", "3"}, nil},
+		{"Recursive", config, strings.Split("recursive", " "), []string{"one", "two", "three,four", "five"}, nil},
+		{"Positional", config, strings.Split("positional dev -lock=false -input=false", " "), []string{"plan", "-var", "env=dev", "-var-file=dev.tfvars", "-lock=false", "-input=false"}, nil},
+		{"Missing positional", config, strings.Split("positional dev", " "), []string{"plan", "-var", "env=dev", "-var-file=dev.tfvars"}, nil},
+		{"All args", config, strings.Split("all_args plan -lock=false", " "), []string{"run-all", "plan", "-lock=false", "--terragrunt-non-interactive"}, nil},
+		{"All args in an arg", config, strings.Split("in_arg a b", " "), []string{"echo", "--args=a b"}, nil},
+		{"Structured", config, strings.Split("structured plan.out", " "), []string{"apply", "plan.out"}, map[string]string{"TF_LOG": "debug", "TF_IN_AUTOMATION": "1"}},
+		{"Nested structured", config, strings.Split("nested -no-color", " "), []string{"apply", "plan.out", "-auto-approve", "-no-color"}, map[string]string{"TF_LOG": "trace", "TF_IN_AUTOMATION": "1"}},
+		{"HCL blocks", hclConfig, strings.Split("pd dev", " "), []string{"plan", "-var", "env=dev"}, map[string]string{"TF_LOG": "debug"}},
+		{"Without command", config, strings.Split("no_command arg", " "), []string{"no_command", "arg"}, nil},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := tt.config.parseAliases(tt.args); !reflect.DeepEqual(got, tt.want) {
+			got, gotEnv := tt.config.parseAliases(tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("TGFConfig.parseAliases() = %v, want %v", got, tt.want)
 			}
+			assert.Equal(t, tt.wantEnv, gotEnv)
 		})
 	}
 }
 
+func TestAliasesUsage(t *testing.T) {
+	t.Parallel()
+
+	config := TGFConfig{
+		Aliases: map[string]interface{}{
+			"plan-dev": map[string]interface{}{"command": "plan -var env=dev", "description": "Plan the dev environment"},
+			"st":       "state list",
+			"invalid":  map[string]interface{}{"description": "No command"},
+		},
+	}
+	assert.Equal(t, "Aliases:\n  plan-dev  Plan the dev environment\n  st        state list\n", config.aliasesUsage())
+	assert.Empty(t, (&TGFConfig{}).aliasesUsage())
+}
+
 func TestIsPartialVersion(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -510,16 +636,24 @@ func createMockTgfZip() ([]byte, error) {
 }
 
 func setupServer(t *testing.T) *httptest.Server {
+	fakeTgfZip, err := createMockTgfZip()
+	if err != nil {
+		t.Errorf("Error creating mock tgf Zip: %v", err)
+	}
+	invalidZip := []byte("Not a zip file")
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/valid/zip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fakeTgfZip, err := createMockTgfZip()
-		if err != nil {
-			t.Errorf("Error creating mock tgf Zip: %v", err)
-		}
 		w.Write(fakeTgfZip)
 	}))
+	mux.HandleFunc("/valid/checksums.txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%x  zip\n", sha256.Sum256(fakeTgfZip))
+	}))
 	mux.HandleFunc("/invalid/zip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Not a zip file"))
+		w.Write(invalidZip)
+	}))
+	mux.HandleFunc("/invalid/checksums.txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%x  zip\n", sha256.Sum256(invalidZip))
 	}))
 	mux.HandleFunc("/error", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Bad request - Go away!", 400)
@@ -529,3 +663,76 @@ func setupServer(t *testing.T) *httptest.Server {
 
 	return ts
 }
+
+func TestTGFConfigBuildArgs(t *testing.T) {
+	t.Parallel()
+
+	home := filepath.ToSlash(must(user.Current()).(*user.User).HomeDir)
+	tests := []struct {
+		name     string
+		build    TGFConfigBuild
+		buildKit bool
+		want     []string
+	}{
+		{"Legacy builder", TGFConfigBuild{}, false, []string{"--force-rm"}},
+		{"BuildKit", TGFConfigBuild{BuildKit: true}, true, nil},
+		{"Secrets", TGFConfigBuild{Secrets: []string{"id=pip,src=~/.pip/pip.conf", "id=npm,env=NPM_TOKEN"}}, true, []string{"--secret", "id=pip,src=" + home + "/.pip/pip.conf", "--secret", "id=npm,env=NPM_TOKEN"}},
+		{"SSH", TGFConfigBuild{SSH: []string{"default", "github=~/.ssh/id_rsa"}}, true, []string{"--ssh", "default", "--ssh", "github=" + home + "/.ssh/id_rsa"}},
+		{"Build args", TGFConfigBuild{Args: map[string]string{"VERSION": "1.0", "USER_HOME": "${HOME}/app"}}, false, []string{"--build-arg", "USER_HOME=" + os.Getenv("HOME") + "/app", "--build-arg", "VERSION=1.0", "--force-rm"}},
+		{"Target and platform", TGFConfigBuild{Target: "runtime", Platform: "linux/arm64", BuildKit: true}, true, []string{"--target", "runtime", "--platform", "linux/arm64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.buildKit, tt.build.useBuildKit())
+			assert.Equal(t, tt.want, tt.build.buildArgs())
+		})
+	}
+
+	build := TGFConfigBuild{Instructions: "RUN ls", source: "/tmp/folder/.tgf.config"}
+	hash := build.hash()
+	build.BuildKit = true
+	assert.NotEqual(t, hash, build.hash(), "Changing the builder produces a new image")
+}
+
+func TestTGFConfigBuildHash(t *testing.T) {
+	tempDir := must(ioutil.TempDir("", "TestTGFConfigBuildHash")).(string)
+	defer os.RemoveAll(tempDir)
+	write := func(name, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tempDir, name)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644))
+	}
+	write("requirements.txt", "boto3")
+	write(".dockerignore", "# Comment\nlogs\n*.tmp\n")
+
+	build := TGFConfigBuild{Instructions: "COPY . /app", Folder: ".", source: filepath.Join(tempDir, ".tgf.config")}
+	hash := build.hash()
+
+	now := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(tempDir, "requirements.txt"), now, now))
+	assert.Equal(t, hash, build.hash(), "The modification time is ignored")
+
+	write("logs/output.log", "ignored")
+	write("file.tmp", "ignored")
+	assert.Equal(t, hash, build.hash(), "The files ignored by .dockerignore are not considered")
+
+	write("requirements.txt", "boto3==1.26")
+	assert.NotEqual(t, hash, build.hash(), "The content is considered")
+	hash = build.hash()
+
+	assert.NotEqual(t, hash, build.withBase("sha256:1234").hash(), "The base image is considered")
+	assert.Equal(t, build.withBase("sha256:1234").hash(), build.withBase("sha256:1234").hash())
+
+	write("docker/Dockerfile", "ARG TGF_BASE_IMAGE\nFROM ${TGF_BASE_IMAGE}\n")
+	build = TGFConfigBuild{Dockerfile: "docker/Dockerfile", source: filepath.Join(tempDir, ".tgf.config")}
+	assert.Equal(t, filepath.Join(tempDir, "docker", "Dockerfile"), build.DockerfilePath())
+	assert.Equal(t, filepath.Join(tempDir, "docker"), build.Dir(), "The folder of the Dockerfile is the default context")
+	hash = build.hash()
+	write("docker/Dockerfile", "ARG TGF_BASE_IMAGE\nFROM ${TGF_BASE_IMAGE}\nRUN ls\n")
+	assert.NotEqual(t, hash, build.hash(), "The Dockerfile is considered")
+	hash = build.hash()
+	build.Args = map[string]string{"VERSION": "1.0"}
+	assert.NotEqual(t, hash, build.hash(), "The build args are considered")
+	hash = build.hash()
+	build.Target = "runtime"
+	assert.NotEqual(t, hash, build.hash(), "The target is considered")
+}
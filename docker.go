@@ -18,7 +18,6 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/blang/semver/v4"
 	"github.com/coveooss/gotemplate/v3/collections"
@@ -40,6 +39,10 @@ const (
 	maxDockerTagLength    = 128
 	dockerMountImagePath  = "/var/tgf"
 	dockerVolumeName      = "tgf"
+	tgfLabelManaged       = "tgf.managed=true" // Label set on every container, image and volume created by tgf
+	tgfLabelHash          = "tgf.hash"
+	tgfLabelBuild         = "tgf.build" // Identifies the configuration of a build (see TGFConfigBuild.configID)
+	tgfLabelVersion       = "tgf.version"
 )
 
 type dockerConfig struct{ *TGFConfig }
@@ -81,6 +84,7 @@ func (docker *dockerConfig) call() int {
 		fmt.Println(imageName)
 		return 0
 	}
+	docker.checkImagePlatform(imageName)
 
 	cwd := filepath.ToSlash(must(filepath.EvalSymlinks(must(os.Getwd()).(string))).(string))
 	currentDrive := fmt.Sprintf("%s/", filepath.VolumeName(cwd))
@@ -89,6 +93,8 @@ func (docker *dockerConfig) call() int {
 
 	dockerArgs := []string{
 		"run",
+		"--label", tgfLabelManaged,
+		"--label", fmt.Sprintf("%s=%s", tgfLabelVersion, version),
 	}
 	if app.DockerInteractive {
 		dockerArgs = append(dockerArgs, "-it")
@@ -138,10 +144,13 @@ func (docker *dockerConfig) call() int {
 		homePath := fmt.Sprintf("/home/%s", username)
 		dockerArgs = append(dockerArgs,
 			"-e", fmt.Sprintf("HOME=%s", homePath),
-			"-v", fmt.Sprintf("%s-%s:%s", dockerVolumeName, username, homePath),
+			"--mount", getVolumeMount(getHomeVolumeName(username), homePath),
 		)
 	}
 
+	if platform, explicit := docker.getPlatform(); explicit {
+		dockerArgs = append(dockerArgs, "--platform", platform)
+	}
 	dockerArgs = append(dockerArgs, config.DockerOptions...)
 
 	switch app.TempDirMountLocation {
@@ -157,8 +166,8 @@ func (docker *dockerConfig) call() int {
 	case mountLocNone:
 		// Nothing to do
 	case mountLocVolume:
-		// docker's -v option will automatically create the volume if it doesn't already exist
-		dockerArgs = append(dockerArgs, "-v", fmt.Sprintf("%s:%s", dockerVolumeName, dockerMountImagePath))
+		// docker's --mount option will automatically create the volume if it doesn't already exist
+		dockerArgs = append(dockerArgs, "--mount", getVolumeMount(dockerVolumeName, dockerMountImagePath))
 	default:
 		// We added a mount location and forgot to handle it...
 		panic(fmt.Sprintf("Unknown mount location '%s'.  Please report a bug.", app.TempDirMountLocation))
@@ -185,6 +194,10 @@ func (docker *dockerConfig) call() int {
 		}
 	}
 
+	credentialsServerArgs, stopCredentialsServer := config.startAwsCredentialsServerIfEnabled(append(dockerArgs, app.DockerOptions...))
+	defer stopCredentialsServer()
+	dockerArgs = append(dockerArgs, credentialsServerArgs...)
+
 	if len(config.Environment) > 0 {
 		for key, val := range config.Environment {
 			os.Setenv(key, val)
@@ -192,7 +205,7 @@ func (docker *dockerConfig) call() int {
 		if log.GetLevel() >= logrus.DebugLevel {
 			exportedVariables := make(collections.StringArray, len(config.Environment))
 			for i, key := range collections.AsDictionary(config.Environment).KeysAsString() {
-				if key == "AWS_SECRET_ACCESS_KEY" || key == "AWS_SESSION_TOKEN" {
+				if key == "AWS_SECRET_ACCESS_KEY" || key == "AWS_SESSION_TOKEN" || key == envAwsContainerAuthorization {
 					exportedVariables[i] = String(fmt.Sprintf("%s = ******", key))
 				} else {
 					exportedVariables[i] = String(fmt.Sprintf("%s = %s", key, config.Environment[key.String()]))
@@ -256,24 +269,36 @@ func runCommands(commands []string) error {
 	return nil
 }
 
-// Returns the image name to use
-// If docker-image-build option has been set, an image is dynamically built and the resulting image digest is returned
-func (docker *dockerConfig) getImage() (name string) {
-	app := docker.tgf
+// getBaseImage returns the name of the image (with its tag) and the image used as base of the builds (locked if required)
+func (docker *dockerConfig) getBaseImage() (name, baseImage string) {
 	name = docker.GetImageName()
 	if !strings.Contains(name, ":") {
 		name += ":latest"
 	}
+	return name, getLockedImageName(name)
+}
 
-	if !app.DockerBuild {
-		return
+// Returns the image name to use
+// If docker-image-build option has been set, an image is dynamically built and the resulting image digest is returned
+func (docker *dockerConfig) getImage() (name string) {
+	app := docker.tgf
+	name, baseImage := docker.getBaseImage()
+	if !app.DockerBuild || len(docker.imageBuildConfigs) == 0 {
+		return baseImage
 	}
 
 	lastHash := ""
-	for i, ib := range docker.imageBuildConfigs {
+	for i, ib := range docker.getBuildConfigs(baseImage) {
 		var temp, folder, dockerFile string
 		var out *os.File
-		if ib.Folder == "" {
+		from := name
+		if i == 0 {
+			from = baseImage
+		}
+		if ib.Dockerfile != "" {
+			// An existing Dockerfile is used, the base image is supplied through the TGF_BASE_IMAGE build arg
+			folder = ib.Dir()
+		} else if ib.Folder == "" {
 			// There is no explicit folder, so we create a temporary folder to store the docker file
 			log.Debug("Creating build folder")
 			temp = must(ioutil.TempDir("", "tgf-dockerbuild")).(string)
@@ -291,7 +316,7 @@ func (docker *dockerConfig) getImage() (name string) {
 
 		if out != nil {
 			log.Debug("Writing instructions to dockerfile")
-			ib.Instructions = fmt.Sprintf("FROM %s\n%s\n", name, ib.Instructions)
+			ib.Instructions = fmt.Sprintf("FROM %s\n%s\n", from, ib.Instructions)
 			must(fmt.Fprintf(out, ib.Instructions))
 			must(out.Close())
 		}
@@ -319,18 +344,26 @@ func (docker *dockerConfig) getImage() (name string) {
 			name = image + ":" + tag[0:maxDockerTagLength]
 		}
 		if app.Refresh || getImageHash(name) != ib.hash() {
-			label := fmt.Sprintf("hash=%s", ib.hash())
-			args := []string{"build", ".", "-f", dockerfilePattern, "--quiet", "--force-rm", "--label", label}
+			if getImageHash(name) != ib.hash() && docker.pullBuildCache(name, ib) {
+				continue
+			}
+			label := fmt.Sprintf("%s=%s", tgfLabelHash, ib.hash())
+			args := []string{"build", ".", "-f", dockerfilePattern, "--quiet", "--label", tgfLabelManaged, "--label", label}
+			args = append(args, "--label", fmt.Sprintf("%s=%s", tgfLabelBuild, ib.configID()))
+			args = append(args, ib.buildArgs()...)
 			if i == 0 && app.Refresh && !app.UseLocalImage {
 				args = append(args, "--pull")
 			}
 			if dockerFile != "" {
 				args = append(args, "--file")
 				args = append(args, filepath.Base(dockerFile))
+			} else if ib.Dockerfile != "" {
+				args = append(args, "--file", ib.DockerfilePath(), "--build-arg", "TGF_BASE_IMAGE="+from)
 			}
 
 			args = append(args, "--tag", name)
 			buildCmd := exec.Command("docker", args...)
+			buildCmd.Env = ib.buildEnv()
 
 			instructions := strings.Join(buildCmd.Args, " ")
 			if ib.Instructions != "" {
@@ -341,57 +374,79 @@ func (docker *dockerConfig) getImage() (name string) {
 			buildCmd.Dir = folder
 			must(buildCmd.Output())
 			pruneDangling()
+			docker.pushBuildCache(name, ib)
 		}
 	}
 
 	return
 }
 
-var pruneDangling = func() {
+// getImageReference returns an immutable reference of a local image (its registry digest or its ID)
+func getImageReference(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	if digest := getImageDigest(image); digest != "" {
+		return digest
+	}
+	if summary := getImageSummary(image); summary != nil {
+		return summary.ID
+	}
+	return ""
+}
+
+// getBuildConfigs returns the build configs with their hash, each build is bound to the one it is based on
+func (config *TGFConfig) getBuildConfigs(baseImage string) []TGFConfigBuild {
+	builds := make([]TGFConfigBuild, len(config.imageBuildConfigs))
+	base := getImageReference(baseImage)
+	platform, explicit := config.getPlatform()
+	for i := range config.imageBuildConfigs {
+		build := config.imageBuildConfigs[i]
+		if build.Platform == "" && explicit {
+			build.Platform = platform
+		}
+		builds[i] = build.withBase(base)
+		base = builds[i].hash()
+	}
+	return builds
+}
+
+// pruneDangling removes the untagged images and the stopped containers created by tgf, it returns the reclaimed space
+var pruneDangling = func() (reclaimed uint64) {
 	cli, ctx := getDockerClient()
 	danglingFilters := filters.NewArgs()
 	danglingFilters.Add("dangling", "true")
-	if _, err := cli.ImagesPrune(ctx, danglingFilters); err != nil {
+	danglingFilters.Add("label", tgfLabelManaged)
+	if report, err := cli.ImagesPrune(ctx, danglingFilters); err != nil {
 		log.Errorln("Error pruning dangling images (Untagged):", err)
+	} else {
+		reclaimed += report.SpaceReclaimed
 	}
-	if _, err := cli.ContainersPrune(ctx, filters.Args{}); err != nil {
+	if report, err := cli.ContainersPrune(ctx, filters.NewArgs(filters.Arg("label", tgfLabelManaged))); err != nil {
 		log.Errorln("Error pruning unused containers:", err)
+	} else {
+		reclaimed += report.SpaceReclaimed
 	}
+	return
 }
 
-func (docker *dockerConfig) prune(images ...string) {
-	cli, ctx := getDockerClient()
-	if len(images) > 0 {
-		current := fmt.Sprintf(">=%s", docker.GetActualImageVersion())
-		for _, image := range images {
-			filters := filters.NewArgs()
-			filters.Add("reference", image)
-			if images, err := cli.ImageList(ctx, types.ImageListOptions{Filters: filters}); err == nil {
-				for _, image := range images {
-					actual := getActualImageVersionFromImageID(image.ID)
-					if actual == "" {
-						for _, tag := range image.RepoTags {
-							matches, _ := reutils.MultiMatch(tag, reImage)
-							if version := matches["version"]; version != "" {
-								if len(version) > len(actual) {
-									actual = version
-								}
-							}
-						}
-					}
-					upToDate, err := CheckVersionRange(actual, current)
-					if err != nil {
-						log.Errorf("Check version for %s vs%s: %v", actual, current, err)
-					} else if !upToDate {
-						for _, tag := range image.RepoTags {
-							deleteImage(tag)
-						}
-					}
-				}
-			}
-		}
+// getHomeVolumeName returns the name of the volume holding the home folder of the user (without its Windows domain)
+func getHomeVolumeName(username string) string {
+	splitUsername := strings.Split(username, "\\")
+	return fmt.Sprintf("%s-%s", dockerVolumeName, splitUsername[len(splitUsername)-1])
+}
+
+// getVolumeMount returns the --mount argument of a docker volume, the volume is labelled if docker creates it
+func getVolumeMount(volume, target string) string {
+	return fmt.Sprintf("type=volume,source=%s,target=%s,volume-label=%s", volume, target, tgfLabelManaged)
+}
+
+// getBuildHash returns the hash of the configuration used to build an image (images built by older versions used the hash label)
+func getBuildHash(labels map[string]string) string {
+	if hash := labels[tgfLabelHash]; hash != "" {
+		return hash
 	}
-	pruneDangling()
+	return labels["hash"]
 }
 
 func deleteImage(id string) {
@@ -476,7 +531,7 @@ func getActualImageVersionInternal(imageName string) string {
 
 func getImageHash(imageName string) string {
 	if image := getImageSummary(imageName); image != nil {
-		return image.Labels["hash"]
+		return getBuildHash(image.Labels)
 	}
 	return ""
 }
@@ -521,15 +576,27 @@ func (docker *dockerConfig) refreshImage(image string) {
 		log.Debugf("Not refreshing %v because `local-image` is set", image)
 		return
 	}
+	if app.skipOffline("the docker images are not refreshed") {
+		if !checkImage(image) {
+			panic(errors.Managed(fmt.Sprintf("The image %s is not available locally and cannot be pulled in offline mode", image)))
+		}
+		return
+	}
 
 	log.Debugln("Checking if there is a newer version of docker image", image)
 
+	platform, explicit := docker.getPlatform()
 	for try := 0; try < 2; try++ {
 		var stderr bytes.Buffer
-		cmd := getDockerUpdateCmd(image)
+		cmd := getDockerUpdateCmd(image, platform)
 		cmd.Stderr = &stderr
 		if err := cmd.Run(); err == nil {
 			break
+		} else if platform != "" && !explicit && strings.Contains(stderr.String(), "no matching manifest") {
+			// The image is not available for the host platform, we let docker select the available one
+			log.Debugf("%v is not available for %s, pulling the default platform", image, platform)
+			platform = ""
+			try--
 		} else if try == 0 && docker.awsConfigExist() {
 			log.Debugf("Failed to pull %v. It is an ECR image, trying again after login to AWS ECR.", image)
 			if err = docker.tryLoginToECR(image); err == nil {
@@ -553,20 +620,30 @@ func (docker *dockerConfig) tryLoginToECR(image string) error {
 	if !(accountOk && regionOk) {
 		return errors.Managed(fmt.Sprintf("%v is not an ECR image", image))
 	}
-	config := must(docker.getAwsConfig(0)).(aws.Config)
+	config, err := docker.getAwsConfig(0)
+	if err != nil {
+		return err
+	}
 	config.Region = region
 	svc := ecr.NewFromConfig(config)
 	requestInput := &ecr.GetAuthorizationTokenInput{RegistryIds: []string{account}}
-	result := must(svc.GetAuthorizationToken(context.TODO(), requestInput)).(*ecr.GetAuthorizationTokenOutput)
+	result, err := svc.GetAuthorizationToken(context.TODO(), requestInput)
+	if err != nil {
+		return err
+	}
 
-	decodedLogin := string(must(base64.StdEncoding.DecodeString(*result.AuthorizationData[0].AuthorizationToken)).([]byte))
+	decodedLogin, err := base64.StdEncoding.DecodeString(*result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return err
+	}
+	username, password := collections.Split2(string(decodedLogin), ":")
 	dockerLoginCmd := exec.Command(
 		"docker", "login", "-u",
-		strings.Split(decodedLogin, ":")[0],
+		username,
 		"--password-stdin",
 		*result.AuthorizationData[0].ProxyEndpoint,
 	)
-	dockerLoginCmd.Stdin = strings.NewReader(strings.Split(decodedLogin, ":")[1])
+	dockerLoginCmd.Stdin = strings.NewReader(password)
 	dockerLoginCmd.Stdout, dockerLoginCmd.Stderr = os.Stdout, os.Stderr
 	if err := dockerLoginCmd.Run(); err != nil {
 		return errors.Managed(err.Error())
@@ -575,8 +652,12 @@ func (docker *dockerConfig) tryLoginToECR(image string) error {
 	return nil
 }
 
-func getDockerUpdateCmd(image string) *exec.Cmd {
-	dockerUpdateCmd := exec.Command("docker", "pull", image)
+func getDockerUpdateCmd(image, platform string) *exec.Cmd {
+	args := []string{"pull", image}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	dockerUpdateCmd := exec.Command("docker", args...)
 	dockerUpdateCmd.Stdout, dockerUpdateCmd.Stderr = os.Stderr, os.Stderr
 	return dockerUpdateCmd
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 )
 
+// Docker runs in a virtual machine, so the host network of the containers is not the actual host network
+const dockerHostNetworkReachesLoopback = false
+
 func getDockerMountArgs() []string {
 	// MacOS has peculiar permissions, so mounting /var/run/docker.sock doesn't work.
 	// See: https://github.com/docker/for-mac/issues/4755#issuecomment-726351209
@@ -102,3 +102,12 @@ func TestGetImage(t *testing.T) {
 		})
 	}
 }
+
+func TestTgfLabels(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "type=volume,source=tgf,target=/var/tgf,volume-label=tgf.managed=true", getVolumeMount(dockerVolumeName, dockerMountImagePath))
+	assert.Equal(t, "1234", getBuildHash(map[string]string{tgfLabelHash: "1234"}))
+	assert.Equal(t, "5678", getBuildHash(map[string]string{"hash": "5678"}), "Images built by previous versions")
+	assert.Empty(t, getBuildHash(nil))
+}
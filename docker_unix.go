@@ -10,6 +10,9 @@ import (
 
 const dockerSocketMountPattern = "%[1]s:%[1]s"
 
+// On Linux, containers using the host network share the host loopback interface
+const dockerHostNetworkReachesLoopback = true
+
 func getDockerMountArgs() []string {
 	return []string{"-v", getDockerSocketMount(), "--group-add", getDockerGroup()}
 }
@@ -4,6 +4,9 @@ import "fmt"
 
 const dockerSocketMountPattern = "/%[1]s:%[1]s"
 
+// Docker runs in a virtual machine, so the host network of the containers is not the actual host network
+const dockerHostNetworkReachesLoopback = false
+
 func getDockerMountArgs() []string {
 	return []string{"-v", getDockerSocketMount(), "--group-add", getDockerGroup()}
 }
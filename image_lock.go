@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coveooss/gotemplate/v3/collections"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const lockFile = ".tgf.lock"
+
+// ImageLock contains the digests of the images pinned with tgf --lock
+type ImageLock struct {
+	Images map[string]string `yaml:"images"`
+	path   string
+}
+
+// findLockFile returns the nearest lock file from the folder up to the root folder
+func findLockFile(folder string) string {
+	file := filepath.Join(folder, lockFile)
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+	if parent := filepath.Dir(folder); parent != folder {
+		return findLockFile(parent)
+	}
+	return ""
+}
+
+// loadImageLock loads the nearest lock file, if there is none, the returned lock targets the current folder
+func loadImageLock() (*ImageLock, error) {
+	lock := &ImageLock{Images: map[string]string{}}
+	cwd := must(os.Getwd()).(string)
+	if lock.path = findLockFile(cwd); lock.path == "" {
+		lock.path = filepath.Join(cwd, lockFile)
+		return lock, nil
+	}
+
+	content, err := ioutil.ReadFile(lock.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", lock.path, err)
+	}
+	if lock.Images == nil {
+		lock.Images = map[string]string{}
+	}
+	return lock, nil
+}
+
+func (lock *ImageLock) save() error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	header := "# This file is maintained by tgf --lock, it pins the digest of the docker images used in this folder\n"
+	return ioutil.WriteFile(lock.path, append([]byte(header), content...), 0644)
+}
+
+// getLockedImageName returns the image reference pinned by digest if the image is locked, otherwise, the image is returned unchanged
+func getLockedImageName(image string) string {
+	lock, err := loadImageLock()
+	if err != nil {
+		log.Warning(err)
+		return image
+	}
+	if digest := lock.Images[normalizeImageName(image)]; digest != "" {
+		locked := fmt.Sprintf("%s@%s", getImageRepository(image), digest)
+		log.Debugf("Image %s is locked to %s by %s", image, locked, lock.path)
+		return locked
+	}
+	return image
+}
+
+// normalizeImageName adds the implicit latest tag if the image has no tag
+func normalizeImageName(image string) string {
+	if getImageRepository(image) == image {
+		return image + ":latest"
+	}
+	return image
+}
+
+// getImageRepository returns the image name without tag nor digest
+func getImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// getImageDigest returns the registry digest of a local image
+func getImageDigest(image string) string {
+	summary := getImageSummary(image)
+	if summary == nil {
+		return ""
+	}
+	repository := getImageRepository(image)
+	for _, repoDigest := range inspectImage(summary.ID).RepoDigests {
+		name, digest := collections.Split2(repoDigest, "@")
+		if name == repository || strings.HasSuffix(name, "/"+repository) {
+			return digest
+		}
+	}
+	return ""
+}
+
+// lockImage pulls the image and records its digest in the lock file under the configured name (i.e. coveo/tgf:1.20-aws
+// for a partial version), so the lock still applies when a newer matching version is published
+func (docker *dockerConfig) lockImage(name, image string) int {
+	lock, err := loadImageLock()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	docker.refreshImage(image)
+	digest := getImageDigest(image)
+	if digest == "" {
+		log.Errorf("Unable to find the registry digest of %s, only images pulled from a registry can be locked", image)
+		return 1
+	}
+
+	lock.Images[normalizeImageName(name)] = digest
+	if err := lock.save(); err != nil {
+		log.Errorf("Unable to save the lock file %s: %v", lock.path, err)
+		return 1
+	}
+	log.Infof("Locked %s to %s (%s) in %s", name, digest, image, lock.path)
+	return 0
+}
+
+// resolveImageName returns the name of the image to run, the version is not resolved if the configured image is locked
+func (docker *dockerConfig) resolveImageName() string {
+	if name := docker.GetImageName(); getLockedImageName(name) != name {
+		return name
+	}
+	docker.resolveImageVersion()
+	return docker.GetImageName()
+}
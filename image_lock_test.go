@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageRepository(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"coveo/tgf", "coveo/tgf"},
+		{"coveo/tgf:1.20-aws", "coveo/tgf"},
+		{"coveo/tgf@sha256:1234", "coveo/tgf"},
+		{"registry:5000/coveo/tgf", "registry:5000/coveo/tgf"},
+		{"registry:5000/coveo/tgf:latest", "registry:5000/coveo/tgf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.want, getImageRepository(tt.image))
+		})
+	}
+	assert.Equal(t, "coveo/tgf:latest", normalizeImageName("coveo/tgf"))
+	assert.Equal(t, "coveo/tgf:aws", normalizeImageName("coveo/tgf:aws"))
+}
+
+func TestImageLock(t *testing.T) {
+	tempDir, _ := filepath.EvalSymlinks(must(ioutil.TempDir("", "TestImageLock")).(string))
+	currentDir, _ := os.Getwd()
+	subFolder := filepath.Join(tempDir, "sub-folder")
+	defer func() {
+		assert.NoError(t, os.Chdir(currentDir))
+		assert.NoError(t, os.RemoveAll(tempDir))
+	}()
+	assert.NoError(t, os.Mkdir(subFolder, os.ModePerm))
+	assert.NoError(t, os.Chdir(subFolder))
+
+	lock, err := loadImageLock()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(subFolder, lockFile), lock.path, "Without lock file, the lock is created in the current folder")
+	assert.Equal(t, "coveo/tgf:1.20-aws", getLockedImageName("coveo/tgf:1.20-aws"))
+
+	lock.path = filepath.Join(tempDir, lockFile)
+	lock.Images["coveo/tgf:1.20-aws"] = "sha256:1234"
+	lock.Images["coveo/tgf:latest"] = "sha256:5678"
+	assert.NoError(t, lock.save())
+
+	assert.Equal(t, "coveo/tgf@sha256:1234", getLockedImageName("coveo/tgf:1.20-aws"), "The lock file of the parent folder is used")
+	assert.Equal(t, "coveo/tgf@sha256:5678", getLockedImageName("coveo/tgf"))
+	assert.Equal(t, "coveo/tgf:1.21", getLockedImageName("coveo/tgf:1.21"))
+}
+
+func TestLockedImageNotResolved(t *testing.T) {
+	tempDir, _ := filepath.EvalSymlinks(must(ioutil.TempDir("", "TestLockedImageNotResolved")).(string))
+	currentDir, _ := os.Getwd()
+	defer func() {
+		assert.NoError(t, os.Chdir(currentDir))
+		assert.NoError(t, os.RemoveAll(tempDir))
+	}()
+	assert.NoError(t, os.Chdir(tempDir))
+
+	tags := []string{"1.20.2-aws", "1.20.3-aws"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": tags})
+	}))
+	defer server.Close()
+	image := strings.TrimPrefix(server.URL, "http://") + "/coveo/tgf"
+
+	newDocker := func() *dockerConfig {
+		version, tag := "1.20", "aws"
+		return &dockerConfig{&TGFConfig{tgf: &TGFApplication{Refresh: true}, Image: image, ImageVersion: &version, ImageTag: &tag}}
+	}
+	assert.Equal(t, image+":1.20.3-aws", newDocker().resolveImageName())
+
+	// The image is locked as tgf --lock does, under the configured name
+	lock, err := loadImageLock()
+	assert.NoError(t, err)
+	lock.Images[normalizeImageName(newDocker().GetImageName())] = "sha256:1234"
+	assert.NoError(t, lock.save())
+
+	// A newer matching version is published after the lock
+	tags = append(tags, "1.20.4-aws")
+	docker := newDocker()
+	imageName := docker.resolveImageName()
+	assert.Equal(t, image+":1.20-aws", imageName, "The version of a locked image must not be resolved")
+	assert.Equal(t, image+"@sha256:1234", getLockedImageName(imageName))
+
+	assert.NoError(t, os.Remove(lock.path))
+	assert.Equal(t, image+":1.20.4-aws", newDocker().resolveImageName(), "Without lock, the newer version is used")
+}
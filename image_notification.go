@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/blang/semver/v4"
+)
+
+// Maximum delay to wait for the image update check once the command is completed
+const imageNotificationTimeout = 2 * time.Second
+
+// findNewerImageVersion returns the highest version of the image allowed by required-image-version if it is newer
+// than the current version or an empty string otherwise
+func (docker *dockerConfig) findNewerImageVersion() string {
+	config := docker.TGFConfig
+	if config.ImageVersion == nil || !reFullVersion.MatchString(*config.ImageVersion) {
+		return ""
+	}
+	current := semver.MustParse(*config.ImageVersion)
+
+	tags, err := docker.listImageTags(config.Image)
+	if err != nil {
+		log.Debugf("Unable to check if a newer version of %s is available: %v", config.Image, err)
+		return ""
+	}
+	suffix := ""
+	if config.ImageTag != nil && *config.ImageTag != "" {
+		suffix = tagSeparator + *config.ImageTag
+	}
+	if latest := findHighestVersion(tags, suffix, config.RequiredVersionRange); latest != "" && semver.MustParse(latest).GT(current) {
+		return latest
+	}
+	return ""
+}
+
+// startImageUpdateCheck looks for a newer image in background (at most once per docker-refresh delay). The returned
+// function prints the notice if a newer image has been found, it must be called once the command is completed.
+func (docker *dockerConfig) startImageUpdateCheck() func() {
+	if docker.tgf.UseLocalImage || docker.tgf.GetImageName || docker.tgf.Offline {
+		return func() {}
+	}
+	touchKey := "notification:" + docker.GetImageName()
+	if lastRefresh(touchKey) < docker.Refresh {
+		return func() {}
+	}
+
+	result := make(chan string, 1)
+	go func() { result <- docker.findNewerImageVersion() }()
+
+	return func() {
+		select {
+		case latest := <-result:
+			touchImageRefresh(touchKey)
+			if latest != "" {
+				log.Warningf("%s %s is available (you use %s)", docker.Image, latest, *docker.ImageVersion)
+			}
+		case <-time.After(imageNotificationTimeout):
+			log.Debugf("The check for a newer version of %s did not complete in time", docker.Image)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindNewerImageVersion(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.23.1-aws", "1.24.3-aws", "1.24.4", "2.0.0-aws"}})
+	}))
+	defer server.Close()
+	image := strings.TrimPrefix(server.URL, "http://") + "/coveo/tgf"
+
+	tests := []struct {
+		name          string
+		version       string
+		requiredRange string
+		want          string
+	}{
+		{"Newer version", "1.23.1", "<2.0.0", "1.24.3"},
+		{"Newer major version", "1.23.1", "", "2.0.0"},
+		{"Up to date", "1.24.3", "<2.0.0", ""},
+		{"Partial version", "1.24", "", ""},
+	}
+	tag := "aws"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := dockerConfig{&TGFConfig{
+				tgf:                  &TGFApplication{Refresh: true},
+				Image:                image,
+				ImageVersion:         &tt.version,
+				ImageTag:             &tag,
+				RequiredVersionRange: tt.requiredRange,
+			}}
+			assert.Equal(t, tt.want, docker.findNewerImageVersion())
+		})
+	}
+}
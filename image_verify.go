@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// ImageVerify describes how the signature of the docker image must be verified
+type ImageVerify struct {
+	PublicKey string `yaml:"public-key,omitempty" json:"public-key,omitempty" hcl:"public-key,omitempty"`
+	Required  bool   `yaml:"required,omitempty" json:"required,omitempty" hcl:"required,omitempty"`
+}
+
+// imageSignature is a signature in the format produced by cosign sign (simple signing payload and its signature)
+type imageSignature struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+}
+
+// loadPublicKey reads the PEM public key, the value could either be the key itself or the path of a file
+func loadPublicKey(value string) (crypto.PublicKey, error) {
+	content := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		var err error
+		if content, err = ioutil.ReadFile(value); err != nil {
+			return nil, fmt.Errorf("unable to read the public key: %w", err)
+		}
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("the public key is not PEM encoded")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// verify ensures that the signature has been produced by the public key and that the payload refers to the digest
+func (signature imageSignature) verify(publicKey crypto.PublicKey, digest string) error {
+	if err := verifySignature(publicKey, signature.Payload, signature.Signature); err != nil {
+		return err
+	}
+
+	var payload struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(signature.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if payload.Critical.Image.Digest != digest {
+		return fmt.Errorf("the signature is for %s", payload.Critical.Image.Digest)
+	}
+	return nil
+}
+
+// verifySignature checks that the signature of the content has been made by the private key matching the public key
+func verifySignature(publicKey crypto.PublicKey, content, signature []byte) error {
+	hash := sha256.Sum256(content)
+	var valid bool
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, hash[:], signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, content, signature)
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if !valid {
+		return errors.New("the signature does not match the public key")
+	}
+	return nil
+}
+
+// getSignatureCacheFilename returns the file where the verified signatures of the digest are kept to allow offline verification
+func getSignatureCacheFilename(digest string) (string, error) {
+	folder, err := getTgfFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(folder, "signatures", strings.Replace(digest, ":", "-", 1)+".json"), nil
+}
+
+// fetchImageSignatures retrieves the cosign signatures attached to the digest in the registry
+func (docker *dockerConfig) fetchImageSignatures(image, digest string) ([]imageSignature, error) {
+	ri, err := docker.getRegistryImage(image)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ri.getManifest(strings.Replace(digest, ":", "-", 1) + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve the signature of %s: %w", image, err)
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid signature manifest for %s: %w", image, err)
+	}
+
+	var signatures []imageSignature
+	for _, layer := range manifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		payload, err := ri.getBlob(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, imageSignature{Payload: payload, Signature: signature})
+	}
+	return signatures, nil
+}
+
+// verifyImageSignature ensures that the image has been signed by the configured public key. Signatures that have
+// already been verified are cached, so the verification of an image already pulled does not require the registry.
+func (docker *dockerConfig) verifyImageSignature(image string) error {
+	publicKey, err := loadPublicKey(docker.ImageVerify.PublicKey)
+	if err != nil {
+		return err
+	}
+	var digest string
+	if i := strings.Index(image, "@"); i >= 0 {
+		digest = image[i+1:]
+	} else {
+		digest = getImageDigest(image)
+	}
+	if digest == "" {
+		return fmt.Errorf("unable to find the registry digest of %s, only images pulled from a registry can be verified", image)
+	}
+
+	cacheFile, _ := getSignatureCacheFilename(digest)
+	var signatures []imageSignature
+	if content, err := ioutil.ReadFile(cacheFile); err == nil && json.Unmarshal(content, &signatures) == nil {
+		for _, signature := range signatures {
+			if signature.verify(publicKey, digest) == nil {
+				log.Debugf("The signature of %s (%s) has been verified with the cached signature", image, digest)
+				return nil
+			}
+		}
+	}
+
+	if docker.tgf.Offline {
+		return fmt.Errorf("the signature of %s (%s) has not been verified yet and cannot be fetched in offline mode", image, digest)
+	}
+	if signatures, err = docker.fetchImageSignatures(image, digest); err != nil {
+		return err
+	}
+	var errs []string
+	for _, signature := range signatures {
+		if err := signature.verify(publicKey, digest); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		log.Debugf("The signature of %s (%s) has been verified", image, digest)
+		if content, err := json.Marshal([]imageSignature{signature}); err == nil && cacheFile != "" {
+			if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err == nil {
+				_ = ioutil.WriteFile(cacheFile, content, 0644)
+			}
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%s (%s) is not signed", image, digest)
+	}
+	return fmt.Errorf("no valid signature for %s (%s): %s", image, digest, strings.Join(errs, ", "))
+}
+
+// verifyImage checks the signature of the image if image-verify is configured. An error is only returned if the
+// verification is required, otherwise, a warning is issued.
+func (docker *dockerConfig) verifyImage(image string) error {
+	if docker.ImageVerify == nil || docker.ImageVerify.PublicKey == "" {
+		return nil
+	}
+	err := docker.verifyImageSignature(image)
+	if err == nil || !docker.ImageVerify.Required {
+		if err != nil {
+			log.Warningf("Image signature verification failed: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("image signature verification failed, the container will not be started: %w", err)
+}
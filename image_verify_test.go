@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testImageDigest = "sha256:4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+func createTestSignature(t *testing.T, digest string) (string, imageSignature) {
+	key := must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)).(*ecdsa.PrivateKey)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: must(x509.MarshalPKIXPublicKey(&key.PublicKey)).([]byte)})
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"coveo/tgf"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, digest))
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	assert.NoError(t, err)
+	return string(publicKey), imageSignature{Payload: payload, Signature: signature}
+}
+
+func TestImageSignatureVerify(t *testing.T) {
+	t.Parallel()
+
+	publicKey, signature := createTestSignature(t, testImageDigest)
+	otherKey, _ := createTestSignature(t, testImageDigest)
+
+	key, err := loadPublicKey(publicKey)
+	assert.NoError(t, err)
+	assert.NoError(t, signature.verify(key, testImageDigest))
+	assert.EqualError(t, signature.verify(key, "sha256:1234"), "the signature is for "+testImageDigest)
+
+	key, err = loadPublicKey(otherKey)
+	assert.NoError(t, err)
+	assert.EqualError(t, signature.verify(key, testImageDigest), "the signature does not match the public key")
+
+	_, err = loadPublicKey("not a key")
+	assert.Error(t, err)
+}
+
+func TestFetchImageSignatures(t *testing.T) {
+	t.Parallel()
+
+	_, signature := createTestSignature(t, testImageDigest)
+	payloadDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(signature.Payload))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/coveo/tgf/manifests/"+strings.Replace(testImageDigest, ":", "-", 1)+".sig", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"layers": []map[string]interface{}{{
+				"digest":      payloadDigest,
+				"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature.Signature)},
+			}},
+		})
+	})
+	mux.HandleFunc("/v2/coveo/tgf/blobs/"+payloadDigest, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signature.Payload)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	docker := dockerConfig{&TGFConfig{tgf: &TGFApplication{}}}
+	image := strings.TrimPrefix(server.URL, "http://") + "/coveo/tgf"
+	signatures, err := docker.fetchImageSignatures(image, testImageDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, []imageSignature{signature}, signatures)
+
+	_, err = docker.fetchImageSignatures(image, "sha256:1234")
+	assert.Error(t, err, "Unsigned image")
+}
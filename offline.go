@@ -0,0 +1,16 @@
+package main
+
+// Features already reported as skipped in offline mode
+var offlineSkipped = map[string]bool{}
+
+// skipOffline returns true if tgf runs in offline mode, the skipped feature is reported once to the user
+func (app *TGFApplication) skipOffline(feature string) bool {
+	if app == nil || !app.Offline {
+		return false
+	}
+	if !offlineSkipped[feature] {
+		offlineSkipped[feature] = true
+		log.Warningf("Offline mode: %s", feature)
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+// autoPlatform is the docker-platform value selecting the platform of the host (default)
+const autoPlatform = "auto"
+
+// getHostPlatform returns the docker platform matching the host architecture, tgf images are always linux images
+func getHostPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// getPlatform returns the platform of the docker images and whether it has been explicitly set by docker-platform.
+// The platform of the host is used if docker-platform is not set.
+func (config *TGFConfig) getPlatform() (platform string, explicit bool) {
+	if platform = strings.TrimSpace(config.DockerPlatform); platform == "" || strings.EqualFold(platform, autoPlatform) {
+		return getHostPlatform(), false
+	}
+	return platform, true
+}
+
+// getImagePlatform returns the platform (os/arch[/variant]) of a local image
+func getImagePlatform(image string) string {
+	cli, ctx := getDockerClient()
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil || inspect.Architecture == "" {
+		return ""
+	}
+	platform := inspect.Os + "/" + inspect.Architecture
+	if inspect.Variant != "" {
+		platform += "/" + inspect.Variant
+	}
+	return platform
+}
+
+// samePlatform compares two platforms, the variant is only considered if both platforms specify it
+func samePlatform(platform1, platform2 string) bool {
+	split1, split2 := strings.Split(platform1, "/"), strings.Split(platform2, "/")
+	length := len(split1)
+	if len(split2) < length {
+		length = len(split2)
+	}
+	if length < 2 {
+		return strings.EqualFold(platform1, platform2)
+	}
+	for i := 0; i < length; i++ {
+		if !strings.EqualFold(split1[i], split2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWrongPlatform returns true if the local image does not match the platform explicitly set by docker-platform
+func (docker *dockerConfig) hasWrongPlatform(image string) bool {
+	platform, explicit := docker.getPlatform()
+	if !explicit {
+		return false
+	}
+	actual := getImagePlatform(image)
+	return actual != "" && !samePlatform(actual, platform)
+}
+
+// checkImagePlatform warns the user if the image does not match the architecture of the host (it runs under emulation)
+func (docker *dockerConfig) checkImagePlatform(image string) {
+	actual := getImagePlatform(image)
+	if actual == "" || samePlatform(actual, getHostPlatform()) {
+		return
+	}
+	if _, explicit := docker.getPlatform(); explicit {
+		log.Debugf("The image %s is built for %s, it runs under emulation on this %s host", image, actual, runtime.GOARCH)
+		return
+	}
+	log.Warningf("The image %s is built for %s, it runs under emulation on this %s host (set docker-platform to choose the platform)", image, actual, runtime.GOARCH)
+}
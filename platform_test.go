@@ -0,0 +1,52 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		platform     string
+		want         string
+		wantExplicit bool
+	}{
+		{"Not set", "", "linux/" + runtime.GOARCH, false},
+		{"Auto", "Auto", "linux/" + runtime.GOARCH, false},
+		{"Explicit", "linux/arm64", "linux/arm64", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platform, explicit := (&TGFConfig{DockerPlatform: tt.platform}).getPlatform()
+			assert.Equal(t, tt.want, platform)
+			assert.Equal(t, tt.wantExplicit, explicit)
+		})
+	}
+}
+
+func TestSamePlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		platform1 string
+		platform2 string
+		want      bool
+	}{
+		{"linux/amd64", "linux/amd64", true},
+		{"linux/amd64", "linux/arm64", false},
+		{"linux/arm64/v8", "linux/arm64", true},
+		{"linux/arm/v6", "linux/arm/v7", false},
+		{"linux/ARM64", "linux/arm64", true},
+		{"", "linux/amd64", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform1+" "+tt.platform2, func(t *testing.T) {
+			assert.Equal(t, tt.want, samePlatform(tt.platform1, tt.platform2))
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/fatih/color"
+)
+
+// Commands requiring a confirmation when the configuration is set to protected: true
+var defaultProtectedCommands = []string{"apply", "destroy", "apply-all", "destroy-all", "state rm"}
+
+// getProtectedCommands returns the list of command patterns requiring a confirmation.
+// The protected setting could either be a boolean (to use the default list) or a list of patterns.
+func (config *TGFConfig) getProtectedCommands() (patterns []string) {
+	switch value := config.Protected.(type) {
+	case bool:
+		if value {
+			return defaultProtectedCommands
+		}
+	case string:
+		switch strings.ToLower(value) {
+		case "true":
+			return defaultProtectedCommands
+		case "", "false":
+			return nil
+		}
+		return []string{value}
+	case []interface{}:
+		for _, pattern := range value {
+			patterns = append(patterns, fmt.Sprint(pattern))
+		}
+	case []string:
+		return value
+	}
+	return
+}
+
+// matchProtectedCommand returns the first pattern matching the arguments or an empty string if there is none.
+// A pattern is a sequence of words (i.e. "state rm") that must be found consecutively in the arguments that are not
+// options. Each word may contain wildcards (i.e. "*-all").
+func matchProtectedCommand(args []string, patterns []string) string {
+	words := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			words = append(words, arg)
+		}
+	}
+
+	for _, pattern := range patterns {
+		patternWords := strings.Fields(pattern)
+		if len(patternWords) == 0 {
+			continue
+		}
+		for i := 0; i+len(patternWords) <= len(words); i++ {
+			matched := true
+			for j, patternWord := range patternWords {
+				if ok, _ := filepath.Match(patternWord, words[i+j]); !ok {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// confirmProtectedCommand asks the user to type the name of the current folder before running a destructive command
+func (config *TGFConfig) confirmProtectedCommand() bool {
+	app := config.tgf
+	command := matchProtectedCommand(app.Unmanaged, config.getProtectedCommands())
+	if command == "" {
+		return true
+	}
+	if app.Yes {
+		log.Debugf("Confirmation of protected command %s bypassed by --yes", command)
+		return true
+	}
+
+	folder := filepath.Base(must(os.Getwd()).(string))
+	target := folder
+	if cachedAwsCallerIdentity != nil {
+		target = fmt.Sprintf("%s (AWS account %s)", folder, aws.ToString(cachedAwsCallerIdentity.Account))
+	}
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		log.Errorf("The command %s is protected in %s and requires a confirmation, use --yes to run it non interactively", command, target)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s The command %s is protected in %s\nType %s to confirm: ",
+		color.YellowString("WARNING:"),
+		color.HiRedString(strings.Join(app.Unmanaged, " ")),
+		color.HiBlueString(target),
+		color.GreenString(folder),
+	)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != folder {
+		log.Error("Confirmation failed, the command has been cancelled")
+		return false
+	}
+	return true
+}
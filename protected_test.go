@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProtectedCommands(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		protected interface{}
+		want      []string
+	}{
+		{"Not set", nil, nil},
+		{"Enabled", true, defaultProtectedCommands},
+		{"Disabled", false, nil},
+		{"Enabled as string", "true", defaultProtectedCommands},
+		{"Single pattern", "apply", []string{"apply"}},
+		{"List of patterns", []interface{}{"apply", "state rm"}, []string{"apply", "state rm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &TGFConfig{Protected: tt.protected}
+			assert.Equal(t, tt.want, config.getProtectedCommands())
+		})
+	}
+}
+
+func TestMatchProtectedCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"", ""},
+		{"plan", ""},
+		{"plan-all --terragrunt-source-update", ""},
+		{"apply", "apply"},
+		{"-var region=us-east-1 apply -auto-approve", "apply"},
+		{"apply-all", "apply-all"},
+		{"destroy-all --terragrunt-non-interactive", "destroy-all"},
+		{"state list", ""},
+		{"state rm aws_instance.test", "state rm"},
+		{"rm state", ""},
+		{"output-all -- -destroy", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchProtectedCommand(strings.Fields(tt.args), defaultProtectedCommands))
+		})
+	}
+
+	assert.Equal(t, "*-all", matchProtectedCommand([]string{"plan-all"}, []string{"*-all"}), "Patterns may contain wildcards")
+}
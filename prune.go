@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/coveooss/gotemplate/v3/collections"
+	"github.com/coveooss/multilogger/reutils"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/go-units"
+)
+
+// pruneImage describes a local image considered by tgf --prune
+type pruneImage struct {
+	ID      string
+	Tags    []string
+	Version string
+	Hash    string // Set on images built from docker-image-build
+	Build   string // Identifies the configuration of the build (tgf.build label)
+	Created time.Time
+	Size    int64
+}
+
+// buildGroup returns the base image (the tag without the hash of the build) and the configuration of a built image, the
+// builds in the same group supersede each other. The builds made before the tgf.build label existed are never grouped.
+func (image pruneImage) buildGroup() string {
+	if image.Hash == "" || image.Build == "" || len(image.Tags) == 0 {
+		return ""
+	}
+	return strings.Replace(image.Tags[0], "-"+image.Hash, "", 1) + "@" + image.Build
+}
+
+// selectImagesToPrune returns the images that should be removed:
+//   - versions older than the current one that are not among the `keep` most recent versions
+//   - builds superseded by a more recent build of the same configuration
+//
+// If olderThan is set, only images created before that delay are selected.
+func selectImagesToPrune(images []pruneImage, current string, keep int, olderThan time.Duration, now time.Time) (result []pruneImage) {
+	parse := func(version string) *semver.Version {
+		if v, err := semver.ParseTolerant(version); err == nil {
+			return &v
+		}
+		return nil
+	}
+
+	// We rank the distinct versions from the most recent to the oldest one
+	versions := []semver.Version{}
+	known := map[string]bool{}
+	latestBuilds := map[string]pruneImage{}
+	for _, image := range images {
+		if v := parse(image.Version); v != nil && !known[v.String()] {
+			known[v.String()] = true
+			versions = append(versions, *v)
+		}
+		if group := image.buildGroup(); group != "" && image.Created.After(latestBuilds[group].Created) {
+			latestBuilds[group] = image
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].GT(versions[j]) })
+	rank := func(v semver.Version) int {
+		for i := range versions {
+			if versions[i].EQ(v) {
+				return i
+			}
+		}
+		return len(versions)
+	}
+
+	currentVersion := parse(current)
+	for _, image := range images {
+		if olderThan > 0 && now.Sub(image.Created) < olderThan {
+			continue
+		}
+		if group := image.buildGroup(); group != "" && latestBuilds[group].ID != image.ID {
+			result = append(result, image)
+			continue
+		}
+		if v := parse(image.Version); v != nil && currentVersion != nil && v.LT(*currentVersion) && rank(*v) >= keep {
+			result = append(result, image)
+		}
+	}
+	return
+}
+
+// getPruneImages returns the local images of the repository
+func getPruneImages(repository string) (result []pruneImage) {
+	cli, ctx := getDockerClient()
+	filters := filters.NewArgs()
+	filters.Add("reference", repository)
+	images, err := cli.ImageList(ctx, types.ImageListOptions{Filters: filters})
+	if err != nil {
+		log.Errorf("Unable to list the images of %s: %v", repository, err)
+		return
+	}
+	for _, image := range images {
+		actual := getActualImageVersionFromImageID(image.ID)
+		if actual == "" {
+			for _, tag := range image.RepoTags {
+				matches, _ := reutils.MultiMatch(tag, reImage)
+				if version := matches["version"]; len(version) > len(actual) {
+					actual = version
+				}
+			}
+		}
+		result = append(result, pruneImage{
+			ID:      image.ID,
+			Tags:    image.RepoTags,
+			Version: actual,
+			Hash:    getBuildHash(image.Labels),
+			Build:   image.Labels[tgfLabelBuild],
+			Created: time.Unix(image.Created, 0),
+			Size:    image.Size,
+		})
+	}
+	return
+}
+
+// isTgfVolume returns true if the volume has been created by tgf: it has the tgf label or, for the volumes created before
+// the label existed, it has the exact name of the tgf cache volume or of the home volume of the user
+func isTgfVolume(volume *types.Volume, username string) bool {
+	if key, value := collections.Split2(tgfLabelManaged, "="); volume.Labels[key] == value {
+		return true
+	}
+	return volume.Name == dockerVolumeName || volume.Name == getHomeVolumeName(username)
+}
+
+// getPruneVolumes returns the tgf volumes (tgf-<user> home volumes and the tgf cache volume) created before the delay
+func getPruneVolumes(olderThan time.Duration) (result []*types.Volume) {
+	cli, ctx := getDockerClient()
+	usage, err := cli.DiskUsage(ctx)
+	if err != nil {
+		log.Errorf("Unable to list the docker volumes: %v", err)
+		return
+	}
+	var username string
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	for _, volume := range usage.Volumes {
+		if !isTgfVolume(volume, username) {
+			continue
+		}
+		if created, err := time.Parse(time.RFC3339, volume.CreatedAt); olderThan > 0 && err == nil && time.Since(created) < olderThan {
+			continue
+		}
+		result = append(result, volume)
+	}
+	return
+}
+
+func (docker *dockerConfig) prune(images ...string) {
+	app := docker.tgf
+	cli, ctx := getDockerClient()
+	var reclaimed int64
+	action := "Removing"
+	if app.DryRun {
+		action = "Would remove"
+	}
+
+	if len(images) > 0 {
+		current := docker.GetActualImageVersion()
+		for _, repository := range images {
+			for _, image := range selectImagesToPrune(getPruneImages(repository), current, app.PruneKeep, app.PruneOlderThan, time.Now()) {
+				fmt.Printf("%s image %s (%s)\n", action, strings.Join(image.Tags, ", "), units.HumanSize(float64(image.Size)))
+				reclaimed += image.Size
+				if !app.DryRun {
+					for _, tag := range image.Tags {
+						deleteImage(tag)
+					}
+				}
+			}
+		}
+	}
+
+	if app.PruneVolumes {
+		for _, volume := range getPruneVolumes(app.PruneOlderThan) {
+			var size int64
+			if volume.UsageData != nil && volume.UsageData.Size > 0 {
+				size = volume.UsageData.Size
+			}
+			fmt.Printf("%s volume %s (%s)\n", action, volume.Name, units.HumanSize(float64(size)))
+			if app.DryRun {
+				reclaimed += size
+			} else if err := cli.VolumeRemove(ctx, volume.Name, false); err != nil {
+				log.Errorf("Unable to remove the volume %s: %v", volume.Name, err)
+			} else {
+				reclaimed += size
+			}
+		}
+	}
+
+	if app.DryRun {
+		fmt.Printf("Total reclaimable space: %s\n", units.HumanSize(float64(reclaimed)))
+		return
+	}
+
+	// Only the dangling images and stopped containers created by tgf are pruned
+	reclaimed += int64(pruneDangling())
+	fmt.Printf("Total reclaimed space: %s\n", units.HumanSize(float64(reclaimed)))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectImagesToPrune(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	images := []pruneImage{
+		{ID: "1", Tags: []string{"coveo/tgf:1.18.0"}, Version: "1.18.0", Created: days(90)},
+		{ID: "2", Tags: []string{"coveo/tgf:1.19.0"}, Version: "1.19.0", Created: days(60)},
+		{ID: "3", Tags: []string{"coveo/tgf:1.20.0"}, Version: "1.20.0", Created: days(10)},
+		{ID: "4", Tags: []string{"coveo/tgf:1.21.0"}, Version: "1.21.0", Created: days(1)},
+		{ID: "5", Tags: []string{"coveo/tgf:1.21.0-live-1234"}, Version: "1.21.0", Hash: "1234", Build: "project1", Created: days(5)},
+		{ID: "6", Tags: []string{"coveo/tgf:1.21.0-live-5678"}, Version: "1.21.0", Hash: "5678", Build: "project1", Created: days(2)},
+		{ID: "7", Tags: []string{"coveo/tgf:custom"}, Created: days(100)},
+		{ID: "8", Tags: []string{"coveo/tgf:1.21.0-live-9012"}, Version: "1.21.0", Hash: "9012", Build: "project2", Created: days(3)},
+		{ID: "9", Tags: []string{"coveo/tgf:1.21.0-live-3456"}, Version: "1.21.0", Hash: "3456", Created: days(4)},
+	}
+	ids := func(images []pruneImage) (result []string) {
+		for _, image := range images {
+			result = append(result, image.ID)
+		}
+		return
+	}
+
+	tests := []struct {
+		name      string
+		current   string
+		keep      int
+		olderThan time.Duration
+		want      []string
+	}{
+		{"Older versions and obsolete builds", "1.21.0", 0, 0, []string{"1", "2", "3", "5"}},
+		{"Keep the 3 most recent versions", "1.21.0", 3, 0, []string{"1", "5"}},
+		{"Older than 30 days", "1.21.0", 0, 30 * 24 * time.Hour, []string{"1", "2"}},
+		{"Current version is not the latest", "1.20.0", 0, 0, []string{"1", "2", "5"}},
+		{"Unknown current version", "", 0, 0, []string{"5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ids(selectImagesToPrune(images, tt.current, tt.keep, tt.olderThan, now)))
+		})
+	}
+}
+
+func TestIsTgfVolume(t *testing.T) {
+	t.Parallel()
+
+	managed := map[string]string{"tgf.managed": "true"}
+	tests := []struct {
+		name   string
+		volume types.Volume
+		want   bool
+	}{
+		{"Labelled home", types.Volume{Name: "tgf-other", Labels: managed}, true},
+		{"Labelled cache", types.Volume{Name: "tgf", Labels: managed}, true},
+		{"Legacy cache", types.Volume{Name: "tgf"}, true},
+		{"Legacy home", types.Volume{Name: "tgf-jsmith"}, true},
+		{"Unrelated volume", types.Volume{Name: "tgf-database"}, false},
+		{"Other label", types.Volume{Name: "tgf-database", Labels: map[string]string{"tgf.managed": "false"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := tt.volume
+			assert.Equal(t, tt.want, isTgfVolume(&volume, `ACME\jsmith`))
+		})
+	}
+}
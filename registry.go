@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/blang/semver/v4"
+	"github.com/coveooss/multilogger/reutils"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	registryPageSize  = 1000
+)
+
+var (
+	registryHTTPClient = &http.Client{Timeout: 30 * time.Second}
+	reFullVersion      = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	reLinkNext         = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+	reAuthParameter    = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// registryImage identifies a repository in an OCI v2 registry
+type registryImage struct {
+	registry    string
+	repository  string
+	credentials string // Base64 encoded user:password, the credentials stored by docker login are used if not set
+}
+
+func parseRegistryImage(image string) registryImage {
+	repository := getImageRepository(image)
+	if parts := strings.SplitN(repository, "/", 2); len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if parts[0] != "docker.io" && parts[0] != "index.docker.io" {
+			return registryImage{registry: parts[0], repository: parts[1]}
+		}
+		repository = parts[1]
+	}
+	if !strings.Contains(repository, "/") {
+		// Official images of Docker Hub are in the library namespace
+		repository = "library/" + repository
+	}
+	return registryImage{registry: dockerHubRegistry, repository: repository}
+}
+
+func (ri registryImage) baseURL() string {
+	if host := strings.Split(ri.registry, ":")[0]; host == "localhost" || host == "127.0.0.1" {
+		return "http://" + ri.registry
+	}
+	return "https://" + ri.registry
+}
+
+// listTags returns all tags of the repository through the OCI distribution API
+func (ri registryImage) listTags() ([]string, error) {
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", ri.baseURL(), ri.repository, registryPageSize)
+	var authorization string
+	tags := []string{}
+	for next != "" {
+		response, err := ri.get(next, &authorization)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid response from %s: %w", ri.registry, err)
+		}
+		tags = append(tags, result.Tags...)
+
+		next = ""
+		if matches := reLinkNext.FindStringSubmatch(response.Header.Get("Link")); matches != nil {
+			link, err := response.Request.URL.Parse(matches[1])
+			if err != nil {
+				return nil, err
+			}
+			next = link.String()
+		}
+	}
+	return tags, nil
+}
+
+// get performs a request on the registry, authenticating (once) as requested by the registry if it responds 401
+func (ri registryImage) get(address string, authorization *string, accept ...string) (*http.Response, error) {
+	authenticated := false
+	for {
+		request, err := http.NewRequest(http.MethodGet, address, nil)
+		if err != nil {
+			return nil, err
+		}
+		if *authorization != "" {
+			request.Header.Set("Authorization", *authorization)
+		}
+		if len(accept) > 0 {
+			request.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		response, err := registryHTTPClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case response.StatusCode == http.StatusOK:
+			return response, nil
+		case response.StatusCode == http.StatusUnauthorized && !authenticated:
+			challenge := response.Header.Get("WWW-Authenticate")
+			response.Body.Close()
+			if *authorization, err = ri.authenticate(challenge); err != nil {
+				return nil, err
+			}
+			authenticated = true
+		case response.StatusCode == http.StatusUnauthorized:
+			response.Body.Close()
+			return nil, fmt.Errorf("%s refused the authentication to %s", ri.registry, address)
+		default:
+			response.Body.Close()
+			return nil, fmt.Errorf("%s returned HTTP status %d", address, response.StatusCode)
+		}
+	}
+}
+
+// authenticate returns the authorization header value answering the WWW-Authenticate challenge of the registry
+func (ri registryImage) authenticate(challenge string) (string, error) {
+	credentials := ri.credentials
+	if credentials == "" {
+		credentials = getDockerCredentials(ri.registry)
+	}
+	if strings.HasPrefix(strings.ToLower(challenge), "basic ") {
+		if credentials == "" {
+			return "", fmt.Errorf("no credentials available for %s", ri.registry)
+		}
+		return "Basic " + credentials, nil
+	}
+	token, err := ri.getToken(challenge, credentials)
+	if err != nil {
+		return "", err
+	}
+	return "Bearer " + token, nil
+}
+
+// getManifest returns the manifest referenced by a tag or a digest
+func (ri registryImage) getManifest(reference string) ([]byte, error) {
+	var authorization string
+	response, err := ri.get(fmt.Sprintf("%s/v2/%s/manifests/%s", ri.baseURL(), ri.repository, reference), &authorization,
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
+
+// getBlob returns the content of a blob and ensures that it matches its digest
+func (ri registryImage) getBlob(digest string) ([]byte, error) {
+	var authorization string
+	response, err := ri.get(fmt.Sprintf("%s/v2/%s/blobs/%s", ri.baseURL(), ri.repository, digest), &authorization)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(content)); actual != digest {
+		return nil, fmt.Errorf("the blob %s of %s has an invalid digest %s", digest, ri.repository, actual)
+	}
+	return content, nil
+}
+
+// getToken retrieves a bearer token as requested by the WWW-Authenticate challenge of the registry
+func (ri registryImage) getToken(challenge, credentials string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported authentication method for %s: %s", ri.registry, challenge)
+	}
+	parameters := map[string]string{}
+	for _, match := range reAuthParameter.FindAllStringSubmatch(challenge, -1) {
+		parameters[match[1]] = match[2]
+	}
+	if parameters["realm"] == "" {
+		return "", fmt.Errorf("no authentication realm for %s", ri.registry)
+	}
+
+	query := url.Values{}
+	if parameters["service"] != "" {
+		query.Set("service", parameters["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", ri.repository))
+	request, err := http.NewRequest(http.MethodGet, parameters["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if credentials != "" {
+		request.Header.Set("Authorization", "Basic "+credentials)
+	}
+
+	response, err := registryHTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to authenticate to %s: HTTP status %d", ri.registry, response.StatusCode)
+	}
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return result.AccessToken, nil
+	}
+	return result.Token, nil
+}
+
+// getDockerCredentials returns the base64 encoded credentials stored by docker login for the registry (if any).
+// Credentials stored in a credentials helper are not supported, anonymous access is used in that case.
+func getDockerCredentials(registry string) string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	content, err := ioutil.ReadFile(filepath.Join(currentUser.HomeDir, ".docker", "config.json"))
+	if err != nil {
+		return ""
+	}
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if json.Unmarshal(content, &dockerConfig) != nil {
+		return ""
+	}
+	keys := []string{registry, "https://" + registry}
+	if registry == dockerHubRegistry {
+		keys = append(keys, "https://index.docker.io/v1/", "docker.io")
+	}
+	for _, key := range keys {
+		if auth := dockerConfig.Auths[key].Auth; auth != "" {
+			if _, err := base64.StdEncoding.DecodeString(auth); err == nil {
+				return auth
+			}
+		}
+	}
+	return ""
+}
+
+// getRegistryImage returns the registry repository of the image, the credentials of ECR registries are retrieved
+// through the AWS API
+func (docker *dockerConfig) getRegistryImage(image string) (registryImage, error) {
+	ri := parseRegistryImage(image)
+	matches, _ := reutils.MultiMatch(image, reECR)
+	if matches["account"] == "" || matches["region"] == "" || !docker.awsConfigExist() {
+		return ri, nil
+	}
+	config, err := docker.getAwsConfig(0)
+	if err != nil {
+		return ri, err
+	}
+	config.Region = matches["region"]
+	result, err := ecr.NewFromConfig(config).GetAuthorizationToken(context.TODO(), &ecr.GetAuthorizationTokenInput{RegistryIds: []string{matches["account"]}})
+	if err != nil {
+		return ri, err
+	}
+	if len(result.AuthorizationData) > 0 {
+		ri.credentials = aws.ToString(result.AuthorizationData[0].AuthorizationToken)
+	}
+	return ri, nil
+}
+
+// listImageTags returns the tags available in the registry for the image. The result is cached under ~/.tgf
+// for the docker-refresh delay.
+func (docker *dockerConfig) listImageTags(image string) ([]string, error) {
+	filename, err := getTouchFilename("tags:" + getImageRepository(image))
+	if err != nil {
+		return docker.fetchImageTags(image)
+	}
+	if info, err := os.Stat(filename); err == nil && !docker.tgf.Refresh && time.Since(info.ModTime()) < docker.Refresh {
+		var tags []string
+		if content, err := ioutil.ReadFile(filename); err == nil && json.Unmarshal(content, &tags) == nil {
+			log.Debugf("Using the cached tags of %s from %s", image, filename)
+			return tags, nil
+		}
+	}
+
+	tags, err := docker.fetchImageTags(image)
+	if err != nil {
+		return nil, err
+	}
+	if content, err := json.Marshal(tags); err == nil {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err == nil {
+			if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+				log.Debugf("Unable to cache the tags of %s: %v", image, err)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// fetchImageTags retrieves the tags from the registry, ECR images are listed through the AWS API
+func (docker *dockerConfig) fetchImageTags(image string) ([]string, error) {
+	matches, _ := reutils.MultiMatch(image, reECR)
+	if matches["account"] == "" || matches["region"] == "" {
+		return parseRegistryImage(image).listTags()
+	}
+
+	if !docker.awsConfigExist() {
+		return nil, errors.New("no AWS configuration available to list ECR images")
+	}
+	config, err := docker.getAwsConfig(0)
+	if err != nil {
+		return nil, err
+	}
+	config.Region = matches["region"]
+	paginator := ecr.NewListImagesPaginator(ecr.NewFromConfig(config), &ecr.ListImagesInput{
+		RegistryId:     aws.String(matches["account"]),
+		RepositoryName: aws.String(parseRegistryImage(image).repository),
+		Filter:         &ecrTypes.ListImagesFilter{TagStatus: ecrTypes.TagStatusTagged},
+	})
+	tags := []string{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range page.ImageIds {
+			if id.ImageTag != nil {
+				tags = append(tags, *id.ImageTag)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// findHighestVersion returns the highest full version (x.y.z) among the tags ending with the suffix that satisfies all the ranges
+func findHighestVersion(tags []string, suffix string, ranges ...string) string {
+	var highest *semver.Version
+	for _, tag := range tags {
+		if !strings.HasSuffix(tag, suffix) {
+			continue
+		}
+		version := strings.TrimSuffix(tag, suffix)
+		if !reFullVersion.MatchString(version) {
+			continue
+		}
+		valid := true
+		for _, versionRange := range ranges {
+			if versionRange == "" {
+				continue
+			}
+			if ok, err := CheckVersionRange(version, versionRange); err != nil || !ok {
+				valid = false
+				break
+			}
+		}
+		if v, err := semver.Make(version); valid && err == nil && (highest == nil || v.GT(*highest)) {
+			highest = &v
+		}
+	}
+	if highest == nil {
+		return ""
+	}
+	return highest.String()
+}
+
+// resolveImageVersion replaces a partial version (i.e. 1.20) or a recommended version range by the highest
+// matching version available in the registry
+func (docker *dockerConfig) resolveImageVersion() {
+	config := docker.TGFConfig
+	var versionRange string
+	switch {
+	case config.IsPartialVersion():
+		versionRange = fmt.Sprintf("=%s.x", *config.ImageVersion)
+	case config.ImageVersion == nil && config.RecommendedImageVersion != "":
+		versionRange = config.RecommendedImageVersion
+	default:
+		return
+	}
+	if docker.tgf.UseLocalImage {
+		log.Debugf("Not resolving the version of %v because `local-image` is set", config.GetImageName())
+		return
+	}
+	if docker.tgf.skipOffline(fmt.Sprintf("the version %s is not resolved from the registry", config.GetImageName())) {
+		return
+	}
+
+	tags, err := docker.listImageTags(config.Image)
+	if err != nil {
+		log.Warningf("Unable to list the tags of %s, using %s: %v", config.Image, config.GetImageName(), err)
+		return
+	}
+
+	suffix := ""
+	if config.ImageTag != nil && *config.ImageTag != "" {
+		suffix = tagSeparator + *config.ImageTag
+	}
+	version := findHighestVersion(tags, suffix, versionRange, config.RequiredVersionRange)
+	if version == "" {
+		log.Debugf("No tag of %s matches %s%s", config.Image, versionRange, suffix)
+		return
+	}
+	log.Debugf("Resolved %s to version %s", config.GetImageName(), version)
+	config.ImageVersion = &version
+}
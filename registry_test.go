@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRegistryImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		image string
+		want  registryImage
+	}{
+		{"ubuntu", registryImage{registry: dockerHubRegistry, repository: "library/ubuntu"}},
+		{"coveo/tgf:1.20-aws", registryImage{registry: dockerHubRegistry, repository: "coveo/tgf"}},
+		{"docker.io/coveo/tgf", registryImage{registry: dockerHubRegistry, repository: "coveo/tgf"}},
+		{"localhost:5000/tgf", registryImage{registry: "localhost:5000", repository: "tgf"}},
+		{"ghcr.io/coveo/tgf:latest", registryImage{registry: "ghcr.io", repository: "coveo/tgf"}},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/tgf", registryImage{registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", repository: "tgf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRegistryImage(tt.image))
+		})
+	}
+}
+
+func TestListTags(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repository:coveo/tgf:pull", r.URL.Query().Get("scope"))
+		json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+	})
+	mux.HandleFunc("/v2/coveo/tgf/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/coveo/tgf/tags/list?n=2&last=1.20.1>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.20.0", "1.20.1"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.20.2-aws", "latest"}})
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	image := registryImage{registry: strings.TrimPrefix(server.URL, "http://"), repository: "coveo/tgf"}
+	tags, err := image.listTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.20.0", "1.20.1", "1.20.2-aws", "latest"}, tags)
+}
+
+func TestListTagsUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		// An anonymous token that is not accepted by the registry
+		tokens++
+		json.NewEncoder(w).Encode(map[string]string{"token": ""})
+	})
+	mux.HandleFunc("/v2/coveo/tgf/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	image := registryImage{registry: strings.TrimPrefix(server.URL, "http://"), repository: "coveo/tgf"}
+	_, err := image.listTags()
+	assert.ErrorContains(t, err, "refused the authentication")
+	assert.Equal(t, 1, tokens, "The authentication must only be attempted once")
+}
+
+func TestFindHighestVersion(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"latest", "aws", "1.19.5", "1.19.5-aws", "1.20.0", "1.20.10", "1.20.9-aws", "1.20.10-aws", "1.21.0", "1.21.0-aws", "1.22", "1.22-aws"}
+	tests := []struct {
+		name   string
+		suffix string
+		ranges []string
+		want   string
+	}{
+		{"Partial version", "", []string{"=1.20.x"}, "1.20.10"},
+		{"Partial version with tag", "-aws", []string{"=1.20.x"}, "1.20.10"},
+		{"Range", "", []string{">=1.19.0 <1.21.0"}, "1.20.10"},
+		{"Required range", "-aws", []string{">=1.19.0", "<1.20.0"}, "1.19.5"},
+		{"No range", "", []string{""}, "1.21.0"},
+		{"No match", "", []string{"=1.18.x"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, findHighestVersion(tags, tt.suffix, tt.ranges...))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// Restart re-run the app with all the arguments passed
+func (config *TGFConfig) Restart() int {
+	return restartProcess(getRestartExecutable())
+}
+
+// getRestartExecutable returns the path of the updated executable
+func getRestartExecutable() string {
+	if executable, err := os.Executable(); err == nil {
+		return executable
+	}
+	if executable, err := exec.LookPath(os.Args[0]); err == nil {
+		return executable
+	}
+	return os.Args[0]
+}
+
+// runChildProcess runs the command attached to the current terminal, the signals received are forwarded to the child
+// and its exit code is returned
+func runChildProcess(cmd *exec.Cmd) int {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Errorln("Error on restart:", err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				// The signal may not be supported (i.e. interrupt on Windows), the console already sends it to the child
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		log.Errorln("Error on restart:", err)
+		return 1
+	}
+	return 0
+}
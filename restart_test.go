@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunChildProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test relies on sh")
+	}
+
+	tests := []struct {
+		name string
+		cmd  *exec.Cmd
+		want int
+	}{
+		{"Success", exec.Command("sh", "-c", "exit 0"), 0},
+		{"Exit code is propagated", exec.Command("sh", "-c", "exit 3"), 3},
+		{"Invalid executable", exec.Command("/tgf/does/not/exist"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, runChildProcess(tt.cmd))
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// restartProcess replaces the current process by the updated executable, so the exit code and the signals are
+// directly handled by the new version
+func restartProcess(executable string) int {
+	err := syscall.Exec(executable, os.Args, os.Environ())
+	log.Errorln("Error on restart:", err)
+	return 1
+}
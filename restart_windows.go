@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// restartProcess runs the updated executable as a child process since Windows cannot replace the current process
+func restartProcess(executable string) int {
+	return runChildProcess(exec.Command(executable, os.Args[1:]...))
+}
@@ -18,12 +18,18 @@ var _ RunnerUpdater = &RunnerUpdaterMock{}
 //
 //         // make and configure a mocked RunnerUpdater
 //         mockedRunnerUpdater := &RunnerUpdaterMock{
+//             ApplyUpdateFunc: func(file string) error {
+// 	               panic("mock out the ApplyUpdate method")
+//             },
 //             DoUpdateFunc: func(url string) error {
 // 	               panic("mock out the DoUpdate method")
 //             },
 //             GetLastRefreshFunc: func(file string) time.Duration {
 // 	               panic("mock out the GetLastRefresh method")
 //             },
+//             GetUpdateURLFunc: func(version string) string {
+// 	               panic("mock out the GetUpdateURL method")
+//             },
 //             GetUpdateVersionFunc: func() (string, error) {
 // 	               panic("mock out the GetUpdateVersion method")
 //             },
@@ -39,6 +45,12 @@ var _ RunnerUpdater = &RunnerUpdaterMock{}
 //             ShouldUpdateFunc: func() bool {
 // 	               panic("mock out the ShouldUpdate method")
 //             },
+//             StageUpdateFunc: func(url string) (string, error) {
+// 	               panic("mock out the StageUpdate method")
+//             },
+//             UpdateInBackgroundFunc: func() bool {
+// 	               panic("mock out the UpdateInBackground method")
+//             },
 //         }
 //
 //         // use mockedRunnerUpdater in code that requires RunnerUpdater
@@ -46,12 +58,18 @@ var _ RunnerUpdater = &RunnerUpdaterMock{}
 //
 //     }
 type RunnerUpdaterMock struct {
+	// ApplyUpdateFunc mocks the ApplyUpdate method.
+	ApplyUpdateFunc func(file string) error
+
 	// DoUpdateFunc mocks the DoUpdate method.
 	DoUpdateFunc func(url string) error
 
 	// GetLastRefreshFunc mocks the GetLastRefresh method.
 	GetLastRefreshFunc func(file string) time.Duration
 
+	// GetUpdateURLFunc mocks the GetUpdateURL method.
+	GetUpdateURLFunc func(version string) string
+
 	// GetUpdateVersionFunc mocks the GetUpdateVersion method.
 	GetUpdateVersionFunc func() (string, error)
 
@@ -67,8 +85,19 @@ type RunnerUpdaterMock struct {
 	// ShouldUpdateFunc mocks the ShouldUpdate method.
 	ShouldUpdateFunc func() bool
 
+	// StageUpdateFunc mocks the StageUpdate method.
+	StageUpdateFunc func(url string) (string, error)
+
+	// UpdateInBackgroundFunc mocks the UpdateInBackground method.
+	UpdateInBackgroundFunc func() bool
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// ApplyUpdate holds details about calls to the ApplyUpdate method.
+		ApplyUpdate []struct {
+			// File is the file argument value.
+			File string
+		}
 		// DoUpdate holds details about calls to the DoUpdate method.
 		DoUpdate []struct {
 			// URL is the url argument value.
@@ -79,6 +108,11 @@ type RunnerUpdaterMock struct {
 			// File is the file argument value.
 			File string
 		}
+		// GetUpdateURL holds details about calls to the GetUpdateURL method.
+		GetUpdateURL []struct {
+			// Version is the version argument value.
+			Version string
+		}
 		// GetUpdateVersion holds details about calls to the GetUpdateVersion method.
 		GetUpdateVersion []struct {
 		}
@@ -96,14 +130,57 @@ type RunnerUpdaterMock struct {
 		// ShouldUpdate holds details about calls to the ShouldUpdate method.
 		ShouldUpdate []struct {
 		}
+		// StageUpdate holds details about calls to the StageUpdate method.
+		StageUpdate []struct {
+			// URL is the url argument value.
+			URL string
+		}
+		// UpdateInBackground holds details about calls to the UpdateInBackground method.
+		UpdateInBackground []struct {
+		}
+	}
+	lockApplyUpdate        sync.RWMutex
+	lockDoUpdate           sync.RWMutex
+	lockGetLastRefresh     sync.RWMutex
+	lockGetUpdateURL       sync.RWMutex
+	lockGetUpdateVersion   sync.RWMutex
+	lockRestart            sync.RWMutex
+	lockRun                sync.RWMutex
+	lockSetLastRefresh     sync.RWMutex
+	lockShouldUpdate       sync.RWMutex
+	lockStageUpdate        sync.RWMutex
+	lockUpdateInBackground sync.RWMutex
+}
+
+// ApplyUpdate calls ApplyUpdateFunc.
+func (mock *RunnerUpdaterMock) ApplyUpdate(file string) error {
+	if mock.ApplyUpdateFunc == nil {
+		panic("RunnerUpdaterMock.ApplyUpdateFunc: method is nil but RunnerUpdater.ApplyUpdate was just called")
 	}
-	lockDoUpdate         sync.RWMutex
-	lockGetLastRefresh   sync.RWMutex
-	lockGetUpdateVersion sync.RWMutex
-	lockRestart          sync.RWMutex
-	lockRun              sync.RWMutex
-	lockSetLastRefresh   sync.RWMutex
-	lockShouldUpdate     sync.RWMutex
+	callInfo := struct {
+		File string
+	}{
+		File: file,
+	}
+	mock.lockApplyUpdate.Lock()
+	mock.calls.ApplyUpdate = append(mock.calls.ApplyUpdate, callInfo)
+	mock.lockApplyUpdate.Unlock()
+	return mock.ApplyUpdateFunc(file)
+}
+
+// ApplyUpdateCalls gets all the calls that were made to ApplyUpdate.
+// Check the length with:
+//     len(mockedRunnerUpdater.ApplyUpdateCalls())
+func (mock *RunnerUpdaterMock) ApplyUpdateCalls() []struct {
+	File string
+} {
+	var calls []struct {
+		File string
+	}
+	mock.lockApplyUpdate.RLock()
+	calls = mock.calls.ApplyUpdate
+	mock.lockApplyUpdate.RUnlock()
+	return calls
 }
 
 // DoUpdate calls DoUpdateFunc.
@@ -168,6 +245,37 @@ func (mock *RunnerUpdaterMock) GetLastRefreshCalls() []struct {
 	return calls
 }
 
+// GetUpdateURL calls GetUpdateURLFunc.
+func (mock *RunnerUpdaterMock) GetUpdateURL(version string) string {
+	if mock.GetUpdateURLFunc == nil {
+		panic("RunnerUpdaterMock.GetUpdateURLFunc: method is nil but RunnerUpdater.GetUpdateURL was just called")
+	}
+	callInfo := struct {
+		Version string
+	}{
+		Version: version,
+	}
+	mock.lockGetUpdateURL.Lock()
+	mock.calls.GetUpdateURL = append(mock.calls.GetUpdateURL, callInfo)
+	mock.lockGetUpdateURL.Unlock()
+	return mock.GetUpdateURLFunc(version)
+}
+
+// GetUpdateURLCalls gets all the calls that were made to GetUpdateURL.
+// Check the length with:
+//     len(mockedRunnerUpdater.GetUpdateURLCalls())
+func (mock *RunnerUpdaterMock) GetUpdateURLCalls() []struct {
+	Version string
+} {
+	var calls []struct {
+		Version string
+	}
+	mock.lockGetUpdateURL.RLock()
+	calls = mock.calls.GetUpdateURL
+	mock.lockGetUpdateURL.RUnlock()
+	return calls
+}
+
 // GetUpdateVersion calls GetUpdateVersionFunc.
 func (mock *RunnerUpdaterMock) GetUpdateVersion() (string, error) {
 	if mock.GetUpdateVersionFunc == nil {
@@ -302,3 +410,60 @@ func (mock *RunnerUpdaterMock) ShouldUpdateCalls() []struct {
 	mock.lockShouldUpdate.RUnlock()
 	return calls
 }
+
+// StageUpdate calls StageUpdateFunc.
+func (mock *RunnerUpdaterMock) StageUpdate(url string) (string, error) {
+	if mock.StageUpdateFunc == nil {
+		panic("RunnerUpdaterMock.StageUpdateFunc: method is nil but RunnerUpdater.StageUpdate was just called")
+	}
+	callInfo := struct {
+		URL string
+	}{
+		URL: url,
+	}
+	mock.lockStageUpdate.Lock()
+	mock.calls.StageUpdate = append(mock.calls.StageUpdate, callInfo)
+	mock.lockStageUpdate.Unlock()
+	return mock.StageUpdateFunc(url)
+}
+
+// StageUpdateCalls gets all the calls that were made to StageUpdate.
+// Check the length with:
+//     len(mockedRunnerUpdater.StageUpdateCalls())
+func (mock *RunnerUpdaterMock) StageUpdateCalls() []struct {
+	URL string
+} {
+	var calls []struct {
+		URL string
+	}
+	mock.lockStageUpdate.RLock()
+	calls = mock.calls.StageUpdate
+	mock.lockStageUpdate.RUnlock()
+	return calls
+}
+
+// UpdateInBackground calls UpdateInBackgroundFunc.
+func (mock *RunnerUpdaterMock) UpdateInBackground() bool {
+	if mock.UpdateInBackgroundFunc == nil {
+		panic("RunnerUpdaterMock.UpdateInBackgroundFunc: method is nil but RunnerUpdater.UpdateInBackground was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockUpdateInBackground.Lock()
+	mock.calls.UpdateInBackground = append(mock.calls.UpdateInBackground, callInfo)
+	mock.lockUpdateInBackground.Unlock()
+	return mock.UpdateInBackgroundFunc()
+}
+
+// UpdateInBackgroundCalls gets all the calls that were made to UpdateInBackground.
+// Check the length with:
+//     len(mockedRunnerUpdater.UpdateInBackgroundCalls())
+func (mock *RunnerUpdaterMock) UpdateInBackgroundCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockUpdateInBackground.RLock()
+	calls = mock.calls.UpdateInBackground
+	mock.lockUpdateInBackground.RUnlock()
+	return calls
+}
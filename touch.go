@@ -9,13 +9,28 @@ import (
 	"time"
 )
 
-func getTouchFilename(image string) (string, error) {
+// tgfFolder overrides the folder where tgf keeps its state (~/.tgf), it is used by the tests
+var tgfFolder string
+
+// getTgfFolder returns the folder where tgf keeps its state (refresh times, caches, etc.)
+func getTgfFolder() (string, error) {
+	if tgfFolder != "" {
+		return tgfFolder, nil
+	}
 	usr, err := user.Current()
 	if err != nil {
 		return "", err
 	}
+	return filepath.Join(usr.HomeDir, ".tgf"), nil
+}
+
+func getTouchFilename(image string) (string, error) {
+	folder, err := getTgfFolder()
+	if err != nil {
+		return "", err
+	}
 	hash := sha1.Sum([]byte(image))
-	return filepath.Join(usr.HomeDir, ".tgf", base64.RawURLEncoding.EncodeToString(hash[:])), nil
+	return filepath.Join(folder, base64.RawURLEncoding.EncodeToString(hash[:])), nil
 }
 
 func getLastRefresh(image string) time.Time {
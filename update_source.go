@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/coveooss/gotemplate/v3/collections"
+	getter "github.com/hashicorp/go-getter"
+)
+
+const (
+	defaultUpdateAPI      = "https://api.github.com/repos/coveooss/tgf"
+	defaultUpdateDownload = "https://github.com/coveo/tgf/releases/download"
+)
+
+var reUpdateManifest = regexp.MustCompile(`(?i)\.(json|ya?ml)$`)
+
+// updateSource describes where the tgf releases are published (update-source)
+type updateSource struct {
+	api      string // GitHub API url of the repository (empty for a mirror)
+	manifest string // Url of the mirror manifest containing the latest version
+	download string // Base url of the archives (followed by v<version>/<archive>)
+}
+
+// Update channels (update-channel)
+const (
+	stableChannel     = "stable"
+	prereleaseChannel = "prerelease"
+)
+
+// updateManifest is the content of the manifest of a mirror
+type updateManifest struct {
+	Version    string `yaml:"version" json:"version" hcl:"version"`
+	Prerelease string `yaml:"prerelease,omitempty" json:"prerelease,omitempty" hcl:"prerelease,omitempty"`
+}
+
+// githubRelease is the description of a release returned by the GitHub API
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// getUpdateSource returns the source of the releases:
+//   - GitHub (default)
+//   - a GitHub Enterprise repository (i.e. https://github.company.com/devops/tgf)
+//   - a manifest on a mirror (i.e. https://mirror.company.com/tgf/latest.json or s3::https://s3.amazonaws.com/bucket/tgf/latest.json),
+//     the archives are expected in v<version>/ besides the manifest
+func (config *TGFConfig) getUpdateSource() updateSource {
+	source := strings.TrimSuffix(strings.TrimSpace(config.UpdateSource), "/")
+	if source == "" {
+		return updateSource{api: defaultUpdateAPI, download: defaultUpdateDownload}
+	}
+	address, query := collections.Split2(source, "?")
+	if reUpdateManifest.MatchString(address) || !isHTTPSource(source) {
+		folder, _ := path.Split(address)
+		if query != "" {
+			query = "?" + query
+		}
+		return updateSource{manifest: source, download: strings.TrimSuffix(folder, "/") + query}
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return updateSource{manifest: source}
+	}
+	api := fmt.Sprintf("%s://%s/api/v3/repos%s", u.Scheme, u.Host, u.Path)
+	if strings.EqualFold(u.Host, "github.com") {
+		api = "https://api.github.com/repos" + u.Path
+	}
+	return updateSource{api: api, download: source + "/releases/download"}
+}
+
+// isHTTPSource returns true if the source can be downloaded with a simple http request (not a go-getter url)
+func isHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// getUpdateChannel returns the update channel, stable unless prerelease is specified
+func (config *TGFConfig) getUpdateChannel() string {
+	switch channel := strings.ToLower(strings.TrimSpace(config.UpdateChannel)); channel {
+	case "", stableChannel:
+		return stableChannel
+	case prereleaseChannel:
+		return prereleaseChannel
+	default:
+		log.Warningf("Invalid update-channel %s (should be %s or %s), using %[2]s", config.UpdateChannel, stableChannel, prereleaseChannel)
+		return stableChannel
+	}
+}
+
+// getLatestVersion returns the latest version published by the source, the prereleases are considered on the
+// prerelease channel
+func (source updateSource) getLatestVersion(channel string) (string, error) {
+	if source.api == "" {
+		content, err := downloadUpdateFile(source.manifest)
+		if err != nil {
+			return "", fmt.Errorf("unable to get the update manifest %s: %w", source.manifest, err)
+		}
+		var manifest updateManifest
+		if err := collections.ConvertData(string(content), &manifest); err != nil {
+			return "", fmt.Errorf("invalid update manifest %s: %w", source.manifest, err)
+		}
+		versions := []string{manifest.Version}
+		if channel == prereleaseChannel {
+			versions = append(versions, manifest.Prerelease)
+		}
+		if latest := highestVersion(versions...); latest != "" {
+			return latest, nil
+		}
+		return "", fmt.Errorf("no version in the update manifest %s", source.manifest)
+	}
+
+	if channel != prereleaseChannel {
+		// The latest release excludes drafts and prereleases
+		content, err := downloadUpdateFile(source.api + "/releases/latest")
+		if err != nil {
+			return "", err
+		}
+		var release githubRelease
+		if err := json.Unmarshal(content, &release); err != nil || release.TagName == "" {
+			return "", errors.New("Error parsing json response")
+		}
+		return strings.TrimPrefix(release.TagName, "v"), nil
+	}
+
+	content, err := downloadUpdateFile(source.api + "/releases?per_page=50")
+	if err != nil {
+		return "", err
+	}
+	var releases []githubRelease
+	if err := json.Unmarshal(content, &releases); err != nil {
+		return "", errors.New("Error parsing json response")
+	}
+	var versions []string
+	for _, release := range releases {
+		if !release.Draft {
+			versions = append(versions, release.TagName)
+		}
+	}
+	if latest := highestVersion(versions...); latest != "" {
+		return latest, nil
+	}
+	return "", errors.New("no release found")
+}
+
+// highestVersion returns the highest valid semver version (without its v prefix)
+func highestVersion(versions ...string) (result string) {
+	var highest *semver.Version
+	for _, version := range versions {
+		v, err := semver.ParseTolerant(version)
+		if err != nil {
+			continue
+		}
+		if highest == nil || v.GT(*highest) {
+			highest, result = &v, v.String()
+		}
+	}
+	return
+}
+
+// getArchiveURL returns the url of the archive of the version for the current platform
+func (source updateSource) getArchiveURL(version string) string {
+	download, query := collections.Split2(source.download, "?")
+	if query != "" {
+		query = "?" + query
+	}
+	return fmt.Sprintf("%s/v%s/%s%s", download, version, getZipName(version, runtime.GOOS, runtime.GOARCH), query)
+}
+
+// downloadUpdateFile returns the content of the file, the go-getter urls (S3, GCS, etc.) are supported
+func downloadUpdateFile(source string) ([]byte, error) {
+	if isHTTPSource(source) {
+		return httpDownload(source)
+	}
+	temp, err := ioutil.TempDir("", "tgf-update")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(temp)
+	destination := filepath.Join(temp, "file")
+	if err := getter.GetFile(destination, source); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(destination)
+}
+
+// httpDownload returns the content of the url
+func httpDownload(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP status error %v", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
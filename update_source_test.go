@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUpdateSource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		source string
+		want   updateSource
+	}{
+		{"Default", "", updateSource{api: defaultUpdateAPI, download: defaultUpdateDownload}},
+		{"GitHub", "https://github.com/company/tgf", updateSource{api: "https://api.github.com/repos/company/tgf", download: "https://github.com/company/tgf/releases/download"}},
+		{"GitHub Enterprise", "https://github.company.com/devops/tgf/", updateSource{api: "https://github.company.com/api/v3/repos/devops/tgf", download: "https://github.company.com/devops/tgf/releases/download"}},
+		{"Mirror", "https://mirror.company.com/tgf/latest.json", updateSource{manifest: "https://mirror.company.com/tgf/latest.json", download: "https://mirror.company.com/tgf"}},
+		{"S3", "s3::https://s3.amazonaws.com/bucket/tgf/latest.yml?region=us-east-1", updateSource{manifest: "s3::https://s3.amazonaws.com/bucket/tgf/latest.yml?region=us-east-1", download: "s3::https://s3.amazonaws.com/bucket/tgf?region=us-east-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, (&TGFConfig{UpdateSource: tt.source}).getUpdateSource())
+		})
+	}
+
+	zip := getZipName("1.21.0", runtime.GOOS, runtime.GOARCH)
+	assert.Equal(t, "https://github.com/coveo/tgf/releases/download/v1.21.0/"+zip, (&TGFConfig{}).GetUpdateURL("1.21.0"))
+	source := (&TGFConfig{UpdateSource: "s3::https://s3.amazonaws.com/bucket/tgf/latest.json?region=us-east-1"}).getUpdateSource()
+	assert.Equal(t, "s3::https://s3.amazonaws.com/bucket/tgf/v1.21.0/"+zip+"?region=us-east-1", source.getArchiveURL("1.21.0"))
+}
+
+func TestGetUpdateVersionFromSource(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/devops/tgf/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.22.0", "prerelease": false, "assets": []}`))
+	})
+	mux.HandleFunc("/api/v3/repos/devops/tgf/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"tag_name": "v1.24.0", "draft": true}, {"tag_name": "v1.23.0-beta.2", "prerelease": true}, {"tag_name": "v1.22.0"}]`))
+	})
+	mux.HandleFunc("/mirror/latest.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "1.23.0", "prerelease": "1.24.0-rc.1"}`))
+	})
+	mux.HandleFunc("/mirror/latest.yml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("version: 1.24.0"))
+	})
+	mux.HandleFunc("/mirror/empty.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		source  string
+		channel string
+		want    string
+		wantErr string
+	}{
+		{"GitHub Enterprise", server.URL + "/devops/tgf", "", "1.22.0", ""},
+		{"GitHub Enterprise prerelease", server.URL + "/devops/tgf", "prerelease", "1.23.0-beta.2", ""},
+		{"JSON manifest", server.URL + "/mirror/latest.json", "stable", "1.23.0", ""},
+		{"JSON manifest prerelease", server.URL + "/mirror/latest.json", "prerelease", "1.24.0-rc.1", ""},
+		{"YAML manifest", server.URL + "/mirror/latest.yml", "", "1.24.0", ""},
+		{"YAML manifest without prerelease", server.URL + "/mirror/latest.yml", "prerelease", "1.24.0", ""},
+		{"No version", server.URL + "/mirror/empty.json", "", "", "no version in the update manifest " + server.URL + "/mirror/empty.json"},
+		{"Missing manifest", server.URL + "/mirror/missing.json", "", "", "unable to get the update manifest " + server.URL + "/mirror/missing.json: HTTP status error 404"},
+		{"Missing repository", server.URL + "/devops/other", "", "", "HTTP status error 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&TGFConfig{UpdateSource: tt.source, UpdateChannel: tt.channel}).GetUpdateVersion()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHighestVersion(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "1.22.0", highestVersion("v1.21.0", "1.22.0", "1.22.0-beta.1", "invalid"))
+	assert.Equal(t, "1.23.0-rc.1", highestVersion("1.22.0", "v1.23.0-rc.1"))
+	assert.Equal(t, "", highestVersion("", "invalid"))
+}